@@ -1,19 +1,26 @@
 package irclib
 
 import (
+	"sort"
+	"strings"
 	"sync"
+
+	"github.com/crimsonvoid/irclib/module"
 )
 
 type access struct {
-	list map[string][]string
-	mut  sync.RWMutex
+	list   map[string][]string
+	config map[string][]string // Groups as last read from the config file
+	mut    sync.RWMutex
 }
 
-// Add `nick` to `group` if `nick` is not in `group`
+// Add `nick` to `group` if `nick` is not in `group`. `nick` may be a nick, a
+// nick!ident@host mask or a $a:account; see module.Source.Match
 func (self *access) Add(nick, group string) bool {
 	self.mut.Lock()
-	defer self.mut.RUnlock()
+	defer self.mut.Unlock()
 
+	nick = strings.ToLower(nick)
 	if self.inGroup(nick, group) {
 		return false
 	}
@@ -25,14 +32,97 @@ func (self *access) Add(nick, group string) bool {
 // Removes `nick` from `group`
 func (self *access) Remove(nick, group string) bool {
 	self.mut.Lock()
-	defer self.mut.RUnlock()
+	defer self.mut.Unlock()
 
 	list, ok := self.list[group]
 	if !ok {
 		return false
 	}
 
-	return remove(&list, nick)
+	removed := remove(&list, nick)
+	self.list[group] = list
+
+	return removed
+}
+
+// Returns `groups` as lists of lowered entries
+func lowerGroups(groups map[string]Groups) map[string][]string {
+	list := make(map[string][]string, len(groups))
+	for name, grp := range groups {
+		l := make([]string, len(grp.Users))
+		for i, u := range grp.Users {
+			l[i] = strings.ToLower(u)
+		}
+		list[name] = l
+	}
+
+	return list
+}
+
+// Replaces the access list with `groups`; entries are lowered
+func (self *access) set(groups map[string]Groups) {
+	list := lowerGroups(groups)
+
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	self.list = list
+}
+
+// Replaces the access list with `groups` read from the config file, which
+// reloadConfig() compares against
+func (self *access) setConfig(groups map[string]Groups) {
+	list, config := lowerGroups(groups), lowerGroups(groups)
+
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	self.list, self.config = list, config
+}
+
+// Applies groups read again from the config file. Only groups that differ from
+// the config file as last read are replaced, so runtime changes to the others
+// are kept. Returns the names of the replaced groups
+func (self *access) reloadConfig(groups map[string]Groups) []string {
+	config := lowerGroups(groups)
+
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	changed := make([]string, 0, 2)
+	for name, users := range config {
+		if old, ok := self.config[name]; !ok || !equalLists(old, users) {
+			self.list[name] = append([]string(nil), users...)
+			changed = append(changed, name)
+		}
+	}
+
+	for name := range self.config {
+		if _, ok := config[name]; !ok {
+			delete(self.list, name)
+			changed = append(changed, name)
+		}
+	}
+
+	self.config = config
+	sort.Strings(changed)
+
+	return changed
+}
+
+// Returns true if `a` and `b` hold the same entries in the same order
+func equalLists(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
 }
 
 // Returns a map[string][]string of groups from access list. If a requested group
@@ -64,14 +154,14 @@ func (self *access) Groups(groups ...string) map[string][]string {
 	return accessGroup
 }
 
-// Returns the first group `nick` occurs or an empty string if `nick` is not is
-// the list of groups provided
-func (self *access) InGroups(nick string, groups ...string) string {
+// Returns the first group an entry matching `src` occurs in or an empty string
+// if `src` is not in the list of groups provided
+func (self *access) InGroups(src module.Source, groups ...string) string {
 	self.mut.RLock()
 	defer self.mut.RUnlock()
 
 	for _, grp := range groups {
-		if self.inGroup(nick, grp) {
+		if src.MatchAny(self.list[grp]) {
 			return grp
 		}
 	}
@@ -79,7 +169,7 @@ func (self *access) InGroups(nick string, groups ...string) string {
 	return ""
 }
 
-// Helper function for access.InGroups()
+// Returns true if the entry `nick` is in `group`
 func (self *access) inGroup(nick, group string) bool {
 	// Locked by callee
 	for _, u := range (*self).list[group] {
@@ -0,0 +1,39 @@
+package irclib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAccessReloadKeepsRuntimeChanges(t *testing.T) {
+	a := new(access)
+	a.setConfig(map[string]Groups{
+		"admin": {Users: []string{"Alice"}},
+		"voice": {Users: []string{"carol"}},
+	})
+
+	a.Add("bob", "admin")
+
+	changed := a.reloadConfig(map[string]Groups{
+		"admin": {Users: []string{"alice"}},
+		"voice": {Users: []string{"carol", "dave"}},
+	})
+
+	if want := []string{"voice"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("reloadConfig changed %v, want %v", changed, want)
+	}
+
+	want := map[string][]string{
+		"admin": {"alice", "bob"},
+		"voice": {"carol", "dave"},
+	}
+	if got := a.Groups(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups() = %v, want %v", got, want)
+	}
+
+	// A group removed from the config is removed
+	a.reloadConfig(map[string]Groups{"admin": {Users: []string{"alice"}}})
+	if _, ok := a.Groups()["voice"]; ok {
+		t.Errorf("Group removed from the config was kept")
+	}
+}
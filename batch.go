@@ -0,0 +1,257 @@
+package irclib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crimsonvoid/irclib/module"
+	irc "github.com/fluffle/goirc/client"
+)
+
+// Batches are collected by the wire, which sees lines before goirc dispatches
+// them. An ended batch is kept until goirc handles its "BATCH -ref" so lines
+// in it still being dispatched can be flagged, then it is delivered as E_BATCH
+
+// A BATCH seen on the wire
+type openBatch struct {
+	batch *module.Batch
+	ended bool // "BATCH -ref" was seen; no lines are added
+}
+
+// A ChatHistory() call waiting for its chathistory batch
+type historyWait struct {
+	target string // Lowered
+	batch  *module.Batch
+	done   chan error
+}
+
+// Returns true if `raw` may start, end or belong to a batch or fail a
+// CHATHISTORY request, so other lines are not parsed
+func batchLine(raw string) bool {
+	if strings.HasPrefix(raw, "@") {
+		if end := strings.IndexByte(raw, ' '); end != -1 && strings.Contains(raw[:end], "batch=") {
+			return true
+		}
+	}
+
+	return strings.Contains(raw, " BATCH ") || strings.Contains(raw, " FAIL CHATHISTORY ")
+}
+
+// Returns true for the batch types servers send chathistory replies in
+func historyBatch(batchType string) bool {
+	return batchType == "chathistory" || batchType == "draft/chathistory"
+}
+
+// Called by Session.wire() with every raw line. Tracks batches received and
+// collects their lines
+func (self *Session) routeBatch(raw string, sent bool) {
+	if sent || !batchLine(raw) {
+		return
+	}
+
+	line := irc.ParseLine(raw)
+	if line == nil {
+		return
+	}
+
+	line = applyTags(line)
+	if line.Time.IsZero() {
+		line.Time = time.Now()
+	}
+
+	ref := replyArg(line, 0)
+
+	self.batchMut.Lock()
+	defer self.batchMut.Unlock()
+
+	switch {
+	case line.Cmd == "BATCH" && strings.HasPrefix(ref, "+"):
+		b := &module.Batch{Ref: ref[1:], Type: replyArg(line, 1)}
+		if len(line.Args) > 2 {
+			b.Params = append([]string(nil), line.Args[2:]...)
+		}
+		if parent, ok := self.batches[line.Tags["batch"]]; ok {
+			b.Parent = parent.batch
+		}
+
+		self.batches[b.Ref] = &openBatch{batch: b}
+	case line.Cmd == "BATCH" && strings.HasPrefix(ref, "-"):
+		open, ok := self.batches[ref[1:]]
+		if !ok {
+			return
+		}
+
+		open.ended = true
+		if historyBatch(open.batch.Type) {
+			self.finishHistory(open.batch)
+		}
+	case line.Cmd == "FAIL" && ref == "CHATHISTORY":
+		if len(self.history) != 0 {
+			w := self.history[0]
+			self.history = self.history[1:]
+			w.done <- fmt.Errorf("%v: %v", replyArg(line, 1), line.Text())
+		}
+	default:
+		open, ok := self.batches[line.Tags["batch"]]
+		if !ok || open.ended {
+			return
+		}
+
+		for b := open.batch; b != nil; b = b.Parent {
+			b.Lines = append(b.Lines, line)
+		}
+	}
+}
+
+// Hands a chathistory batch to the oldest ChatHistory() call for its target.
+// Locked by callee
+func (self *Session) finishHistory(b *module.Batch) {
+	target := ""
+	if len(b.Params) != 0 {
+		target = strings.ToLower(b.Params[0])
+	}
+
+	for i, w := range self.history {
+		if w.target == target {
+			self.history = append(self.history[:i], self.history[i+1:]...)
+			w.batch = b
+			w.done <- nil
+
+			return
+		}
+	}
+}
+
+// Called by goirc with each BATCH after the wire. Returns the batch a
+// "BATCH -ref" ended, which is forgotten, otherwise nil
+func (self *Session) endBatch(line *irc.Line) *module.Batch {
+	ref := replyArg(line, 0)
+	if !strings.HasPrefix(ref, "-") {
+		return nil
+	}
+
+	self.batchMut.Lock()
+	defer self.batchMut.Unlock()
+
+	open, ok := self.batches[ref[1:]]
+	if !ok {
+		return nil
+	}
+	delete(self.batches, ref[1:])
+
+	return open.batch
+}
+
+// Returns the batch `line` arrived in without its lines, which the wire may
+// still be adding to, or nil
+func (self *Session) lineBatch(line *irc.Line) *module.Batch {
+	ref, ok := line.Tags["batch"]
+	if !ok {
+		return nil
+	}
+
+	self.batchMut.Lock()
+	defer self.batchMut.Unlock()
+
+	if open, ok := self.batches[ref]; ok {
+		return batchInfo(open.batch)
+	}
+
+	return nil
+}
+
+// Returns a copy of `b` and its parents without lines
+func batchInfo(b *module.Batch) *module.Batch {
+	if b == nil {
+		return nil
+	}
+
+	return &module.Batch{Ref: b.Ref, Type: b.Type, Params: b.Params, Parent: batchInfo(b.Parent)}
+}
+
+// Forgets open batches and fails ChatHistory() calls, such as after
+// disconnecting
+func (self *Session) resetBatches(err error) {
+	self.batchMut.Lock()
+	defer self.batchMut.Unlock()
+
+	self.batches = make(map[string]*openBatch)
+
+	for _, w := range self.history {
+		w.done <- err
+	}
+	self.history = nil
+}
+
+// Sends CHATHISTORY and returns up to `limit` messages sent to `target` before
+// `before`, or the latest if it is zero, oldest first
+func (self *Session) ChatHistory(ctx context.Context, target string, before time.Time, limit int) ([]*module.Message, error) {
+	if !self.Connected() {
+		return nil, errors.New("Not connected to " + self.Name)
+	}
+	if !self.HasCap("batch") || !(self.HasCap("draft/chathistory") || self.HasCap("chathistory")) {
+		return nil, errors.New(self.Name + " does not support chathistory")
+	}
+	if limit <= 0 {
+		return nil, errors.New("Limit must be positive")
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, module.QueryTimeout)
+		defer cancel()
+	}
+
+	w := &historyWait{target: strings.ToLower(target), done: make(chan error, 1)}
+
+	self.batchMut.Lock()
+	self.history = append(self.history, w)
+	self.batchMut.Unlock()
+
+	if before.IsZero() {
+		self.Conn.Raw(fmt.Sprintf("CHATHISTORY LATEST %v * %v", target, limit))
+	} else {
+		stamp := before.UTC().Format("2006-01-02T15:04:05.000Z")
+		self.Conn.Raw(fmt.Sprintf("CHATHISTORY BEFORE %v timestamp=%v %v", target, stamp, limit))
+	}
+
+	select {
+	case err := <-w.done:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		self.batchMut.Lock()
+		for i, waiting := range self.history {
+			if waiting == w {
+				self.history = append(self.history[:i], self.history[i+1:]...)
+				break
+			}
+		}
+		self.batchMut.Unlock()
+
+		return nil, ctx.Err()
+	}
+
+	info := batchInfo(w.batch)
+	msgs := make([]*module.Message, 0, len(w.batch.Lines))
+	for _, line := range w.batch.Lines {
+		account, ok := line.Tags["account"]
+		if !ok && !self.HasCap("account-tag") {
+			account = self.Account(line.Nick)
+		}
+
+		msgs = append(msgs, &module.Message{
+			Line:    line,
+			Network: self.Name,
+			Client:  self,
+			Account: account,
+			Batch:   info,
+		})
+	}
+
+	return msgs, nil
+}
@@ -0,0 +1,223 @@
+package irclib
+
+import (
+	"strings"
+
+	irc "github.com/fluffle/goirc/client"
+)
+
+// Capabilities requested when the server offers them unless ServerInfo.Caps
+// or Network.Caps lists others. "sasl" is added when SASL is configured
+var defaultCaps = []string{
+	"account-notify", "account-tag", "away-notify", "batch", "chghost",
+	"extended-join", "message-tags", "multi-prefix", "server-time",
+	"draft/chathistory",
+}
+
+// Registers handlers to negotiate IRCv3 capabilities. The wire sends CAP LS
+// when it dials, before goirc sends NICK and USER, so the server holds
+// registration until CAP END. Capabilities offered later with CAP NEW are
+// requested too
+func (self *Session) setupCaps() {
+	// RPL_WELCOME; negotiation is over, later ACKs need no CAP END
+	self.Conn.HandleFunc("001", func(con *irc.Conn, line *irc.Line) {
+		self.mut.Lock()
+		self.welcomed = true
+		self.mut.Unlock()
+	})
+
+	// chghost: CHGHOST ident host
+	self.Conn.HandleFunc("CHGHOST", func(con *irc.Conn, line *irc.Line) {
+		st := con.StateTracker()
+		if st == nil || len(line.Args) < 2 {
+			return
+		}
+
+		if n := st.GetNick(line.Nick); n != nil {
+			st.NickInfo(line.Nick, line.Args[0], line.Args[1], n.Name)
+		}
+	})
+
+	self.Conn.HandleFunc("CAP", func(con *irc.Conn, line *irc.Line) {
+		if len(line.Args) < 3 {
+			return
+		}
+
+		caps := strings.Fields(line.Args[len(line.Args)-1])
+
+		switch strings.ToUpper(line.Args[1]) {
+		case "LS":
+			self.mut.Lock()
+			self.capLS = append(self.capLS, caps...)
+			ls := self.capLS
+			self.mut.Unlock()
+
+			// "CAP * LS * :caps" means more lines follow
+			if len(line.Args) > 3 && line.Args[2] == "*" {
+				return
+			}
+
+			req := self.wantedCaps(ls)
+			if len(req) == 0 {
+				con.Raw("CAP END")
+
+				return
+			}
+
+			con.Raw("CAP REQ :" + strings.Join(req, " "))
+		case "ACK":
+			self.mut.Lock()
+			for _, c := range caps {
+				if strings.HasPrefix(c, "-") {
+					removeCap(&self.caps, c[1:])
+				} else if !hasCap(self.caps, c) {
+					self.caps = append(self.caps, c)
+				}
+			}
+			welcomed := self.welcomed
+			self.mut.Unlock()
+
+			if welcomed {
+				return
+			}
+
+			// SASL sends CAP END once authentication finishes
+			if hasCap(caps, "sasl") && self.sasl.Mechanism != "" {
+				con.Raw("AUTHENTICATE " + self.sasl.Mechanism)
+
+				return
+			}
+
+			con.Raw("CAP END")
+		case "NAK":
+			self.manager.core.Logger.Warnf("%v refused capabilities %v\n", self.Name, caps)
+
+			self.mut.RLock()
+			welcomed := self.welcomed
+			self.mut.RUnlock()
+
+			if !welcomed {
+				con.Raw("CAP END")
+			}
+		case "NEW":
+			self.mut.Lock()
+			self.capLS = append(self.capLS, caps...)
+			self.mut.Unlock()
+
+			if req := self.wantedCaps(caps); len(req) != 0 {
+				con.Raw("CAP REQ :" + strings.Join(req, " "))
+			}
+		case "DEL":
+			self.mut.Lock()
+			for _, c := range caps {
+				removeCap(&self.capLS, c)
+				removeCap(&self.caps, c)
+			}
+			self.mut.Unlock()
+
+			self.manager.core.Logger.Infof("%v removed capabilities %v\n", self.Name, caps)
+		}
+	})
+}
+
+// Returns the capabilities to request out of those the server offered
+func (self *Session) wantedCaps(ls []string) []string {
+	self.mut.RLock()
+	wanted := self.network.Caps
+	tracking := self.network.Tracking
+	sasl := self.sasl.Mechanism != ""
+	self.mut.RUnlock()
+
+	if sasl {
+		wanted = append([]string{"sasl"}, wanted...)
+	}
+
+	req := make([]string, 0, len(wanted))
+	for _, c := range wanted {
+		switch {
+		case !hasCap(ls, c):
+			if c == "sasl" {
+				self.manager.core.Logger.Warnf("%v does not support SASL\n", self.Name)
+			}
+		case c == "multi-prefix" && tracking:
+			// goirc's state tracking reads a single prefix from NAMES
+			self.manager.core.Logger.Warnf("%v: multi-prefix is not requested with tracking\n", self.Name)
+		default:
+			req = append(req, c)
+		}
+	}
+
+	return req
+}
+
+// Returns the capabilities the server acknowledged
+func (self *Session) Caps() []string {
+	self.mut.RLock()
+	defer self.mut.RUnlock()
+
+	caps := make([]string, len(self.caps))
+	copy(caps, self.caps)
+
+	return caps
+}
+
+// Returns true if the server acknowledged capability `name`
+func (self *Session) HasCap(name string) bool {
+	self.mut.RLock()
+	defer self.mut.RUnlock()
+
+	return hasCap(self.caps, name)
+}
+
+// Returns true if `name` is in a list of capabilities; values such as
+// "sasl=PLAIN,EXTERNAL" are ignored
+func hasCap(caps []string, name string) bool {
+	for _, c := range caps {
+		if i := strings.IndexByte(c, '='); i != -1 {
+			c = c[:i]
+		}
+
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns true if `line` is one of ours sent back by echo-message
+func (self *Session) isEcho(line *irc.Line) bool {
+	switch line.Cmd {
+	case irc.PRIVMSG, irc.NOTICE, irc.ACTION, irc.CTCP, irc.CTCPREPLY, "TAGMSG":
+	default:
+		return false
+	}
+
+	return line.Nick != "" && strings.EqualFold(line.Nick, self.Nick()) && self.HasCap("echo-message")
+}
+
+// Forgets the capabilities and SASL state of the last connection
+func (self *Session) resetCaps() {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	self.authed = false
+	self.welcomed = false
+	self.capLS = self.capLS[:0]
+	self.caps = self.caps[:0]
+}
+
+// Removes capability `name` from a list of capabilities
+func removeCap(caps *[]string, name string) {
+	for i, c := range *caps {
+		if j := strings.IndexByte(c, '='); j != -1 {
+			c = c[:j]
+		}
+
+		if strings.EqualFold(c, name) {
+			*caps = append((*caps)[:i], (*caps)[i+1:]...)
+
+			return
+		}
+	}
+}
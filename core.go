@@ -3,6 +3,7 @@ package irclib
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/crimsonvoid/console/styles"
 	"github.com/crimsonvoid/irclib/module"
@@ -31,7 +32,9 @@ func newCore() *module.Module {
 }
 
 func (self *ModManager) registerCoreCommands() {
-	self.core.Conn = self.Conn
+	self.core.Conn = self.sessions[0].Conn
+	self.core.Client = self.client
+	self.core.Access = self.Config.Access
 
 	errFns := []func() error{
 		// Quit
@@ -40,12 +43,24 @@ func (self *ModManager) registerCoreCommands() {
 		self.regCoreForceQuit,
 		// List modules
 		self.regCoreListModules,
+		// Load, unload or restart modules
+		self.regCoreModuleManage,
+		// List networks
+		self.regCoreListNetworks,
+		// Show send queues
+		self.regCoreSendQueue,
 		// Join or Part channels
 		self.regCoreChanManage,
 		// Print access list
 		self.regCoreAccessList,
 		// Add or remove nicks from access list
 		self.regCoreAccessManip,
+		// Save or reload state files
+		self.regCoreState,
+		// Record raw lines
+		self.regCoreRecord,
+		// IRC help command
+		self.regCoreHelp,
 	}
 
 	for _, fn := range errFns {
@@ -89,14 +104,92 @@ func (self *ModManager) regCoreListModules() error {
 				mod.Description())
 		}
 
+		for _, mod := range self.unloaded {
+			msg += fmt.Sprintf("%v - %v (unloaded)\n",
+				styles.Red.Fg("%v", mod.Name()),
+				mod.Description())
+		}
+
+		consLog.Print(msg)
+	})
+
+	return err
+}
+
+// Load an unloaded module, unload a module or restart a running module
+func (self *ModManager) regCoreModuleManage() error {
+	re := regexp.MustCompile(`^(?P<cmd>load|unload|restart)\s+(?P<module>\S+)$`)
+	err := self.core.Console.Register(re, func(trigger string) {
+		groups, _ := matchGroups(re, trigger)
+		name := strings.ToLower(groups["module"])
+
+		var err error
+		switch groups["cmd"] {
+		case "load":
+			err = self.Load(name)
+		case "unload":
+			err = self.Unregister(name)
+		case "restart":
+			err = self.Restart(name)
+		}
+
+		if err != nil {
+			consLog.Println(styles.Red.Fg("Unable to %v %v: %v", groups["cmd"], name, err))
+			self.core.Logger.Errorf("Unable to %v %v: %v\n", groups["cmd"], name, err)
+
+			return
+		}
+
+		consLog.Println(styles.Green.Fg("%ved %v", groups["cmd"], name))
+		self.core.Logger.Infof("%v %v\n", groups["cmd"], name)
+	})
+
+	return err
+}
+
+func (self *ModManager) regCoreListNetworks() error {
+	err := self.core.Console.Register("networks", func(trigger string) {
+		msg := ""
+		for _, s := range self.sessions {
+			color := styles.Green
+			if !s.Connected() {
+				color = styles.Red
+			}
+
+			msg += fmt.Sprintf("%v - %v %v\n",
+				color.Fg("%v", s.Name),
+				s.Conn.Config().Server,
+				s.Chans())
+		}
+
+		consLog.Print(msg)
+	})
+
+	return err
+}
+
+// Shows the send queue of every network
+func (self *ModManager) regCoreSendQueue() error {
+	err := self.core.Console.Register("sendq", func(trigger string) {
+		msg := ""
+		for _, s := range self.sessions {
+			stats := s.SendStats()
+
+			msg += fmt.Sprintf("%v - queued %v (high %v, normal %v, low %v) for %v targets, "+
+				"oldest %v, max %v, tokens %v, sent %v, dropped %v\n",
+				s.Name, stats.Depth, stats.High, stats.Normal, stats.Low, stats.Targets,
+				stats.Oldest, stats.MaxDepth, stats.Tokens, stats.Sent, stats.Dropped)
+		}
+
 		consLog.Print(msg)
 	})
 
 	return err
 }
 
+// Join or part a channel on one network, or on every network if none is given
 func (self *ModManager) regCoreChanManage() error {
-	re := regexp.MustCompile(`^(?P<cmd>join|part)\s(?P<chan>.*)$`)
+	re := regexp.MustCompile(`^(?P<cmd>join|part)\s((?P<network>[^#\s]+)\s)?(?P<chan>\S+)$`)
 	err := self.core.Console.Register(re, func(trigger string) {
 		groups, _ := matchGroups(re, trigger)
 		channel := groups["chan"]
@@ -104,12 +197,26 @@ func (self *ModManager) regCoreChanManage() error {
 			channel = "#" + channel
 		}
 
-		if groups["cmd"] == "join" {
-			self.Conn.Join(channel)
-			self.core.Logger.Infoln("Joined", channel)
-		} else {
-			self.Conn.Part(channel)
-			self.core.Logger.Infoln("Parted", channel)
+		sessions := self.sessions
+		if groups["network"] != "" {
+			s := self.Session(groups["network"])
+			if s == nil {
+				consLog.Println("Unknown network", groups["network"])
+
+				return
+			}
+
+			sessions = []*Session{s}
+		}
+
+		for _, s := range sessions {
+			if groups["cmd"] == "join" {
+				s.Join(channel)
+				self.core.Logger.Infoln("Joined", channel, "on", s.Name)
+			} else {
+				s.Part(channel)
+				self.core.Logger.Infoln("Parted", channel, "on", s.Name)
+			}
 		}
 	})
 
@@ -146,6 +253,7 @@ func (self *ModManager) regCoreAccessManip() error {
 			}
 		}
 
+		self.saveAccess()
 		consLog.Printf(msg, groups["nick"], groups["group"])
 		self.core.Logger.Infof(msg, groups["nick"], groups["group"])
 	})
@@ -153,6 +261,131 @@ func (self *ModManager) regCoreAccessManip() error {
 	return err
 }
 
+// Save the access list and every module's allow/deny lists, or reload config
+// and state files
+func (self *ModManager) regCoreState() error {
+	err := self.core.Console.Register("save", func(trigger string) {
+		errMap := self.SaveState()
+
+		if len(errMap) == 0 {
+			consLog.Println(styles.Green.Fg("Saved state without errors"))
+			self.core.Logger.Infoln("Saved state without errors")
+
+			return
+		}
+
+		out := styles.Red.Fg("Errors when attempting to save state\n")
+		for modName, err := range errMap {
+			out += fmt.Sprintf("  %v: %v\n", modName, err)
+			self.core.Logger.Errorf("Save state %v: %v\n", modName, err)
+		}
+		consLog.Print(out)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return self.core.Console.Register("reload", func(trigger string) {
+		self.coreReload()
+	})
+}
+
+// Start recording raw lines to a file, stop, or show where they are recorded
+func (self *ModManager) regCoreRecord() error {
+	re := regexp.MustCompile(`^record(\s(?P<file>.+))?$`)
+	err := self.core.Console.Register(re, func(trigger string) {
+		groups, _ := matchGroups(re, trigger)
+		file := strings.TrimSpace(groups["file"])
+
+		switch file {
+		case "":
+			if rec := self.Recording(); rec != "" {
+				consLog.Println("Recording to", rec)
+			} else {
+				consLog.Println("Not recording")
+			}
+		case "stop":
+			if err := self.StopRecording(); err != nil {
+				consLog.Println(styles.Red.Fg("%v", err))
+
+				return
+			}
+
+			consLog.Println("Stopped recording")
+			self.core.Logger.Infoln("Stopped recording")
+		default:
+			if err := self.StartRecording(file); err != nil {
+				consLog.Println(styles.Red.Fg("Unable to record to %v: %v", file, err))
+
+				return
+			}
+
+			consLog.Println("Recording to", file)
+			self.core.Logger.Infoln("Recording to", file)
+		}
+	})
+
+	return err
+}
+
+// Lists commands of every module that is enabled and allows the user and
+// channel, or shows the usage of one command
+func (self *ModManager) regCoreHelp() error {
+	err := self.core.RegisterCommand(&module.Command{
+		Name: "help",
+		Help: "List commands or show how to use one",
+		Args: []module.Arg{{Name: "command", Optional: true}},
+		Fn: func(ev *module.CommandEvent) {
+			mods := append([]*module.Module{self.core}, self.Modules()...)
+			name := ev.String("command")
+
+			if name != "" {
+				name = strings.TrimPrefix(name, module.CmdPrefix().Prefix)
+
+				for _, mod := range mods {
+					if !mod.Allowed(ev.Message) {
+						continue
+					}
+
+					if cmd := mod.FindCommand(name); cmd != nil {
+						ev.Replyf("%v - %v", cmd.Usage(), cmd.Help)
+
+						return
+					}
+				}
+
+				ev.Replyf("No such command %v", name)
+
+				return
+			}
+
+			list := make([]string, 0, len(mods))
+			for _, mod := range mods {
+				if !mod.Allowed(ev.Message) {
+					continue
+				}
+
+				cmds := mod.Commands()
+				if len(cmds) == 0 {
+					continue
+				}
+
+				names := make([]string, len(cmds))
+				for i, cmd := range cmds {
+					names[i] = cmd.Name
+				}
+
+				list = append(list, fmt.Sprintf("%v: %v", mod.Name(), strings.Join(names, ", ")))
+			}
+
+			ev.Reply("Commands - " + strings.Join(list, "; "))
+		},
+	})
+
+	return err
+}
+
 func (self *ModManager) coreDisconnect() {
 	errors := self.Disconnect()
 
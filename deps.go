@@ -0,0 +1,207 @@
+package irclib
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/crimsonvoid/irclib/module"
+)
+
+// Returns the name modules are matched against Requires and After with, which
+// are lowered
+func depName(mod *module.Module) string {
+	return strings.ToLower(mod.Name())
+}
+
+// Returns modules grouped into levels so every module comes after the
+// registered modules it Requires or starts After. Modules in a level do not
+// depend on each other. Returns an error naming a cycle
+func startLevels(mods []*module.Module) ([][]*module.Module, error) {
+	byName := make(map[string]*module.Module, len(mods))
+	for _, mod := range mods {
+		byName[depName(mod)] = mod
+	}
+
+	deps := make(map[string][]string, len(mods))
+	for _, mod := range mods {
+		name := depName(mod)
+
+		for _, dep := range append(mod.Requires(), mod.After()...) {
+			if _, ok := byName[dep]; ok && !inList(deps[name], dep) {
+				deps[name] = append(deps[name], dep)
+			}
+		}
+	}
+
+	levels := make([][]*module.Module, 0, 3)
+	placed := make(map[string]bool, len(mods))
+	for len(placed) != len(mods) {
+		level := make([]*module.Module, 0, len(mods)-len(placed))
+
+		for _, mod := range mods {
+			if placed[depName(mod)] {
+				continue
+			}
+
+			ready := true
+			for _, dep := range deps[depName(mod)] {
+				if !placed[dep] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				level = append(level, mod)
+			}
+		}
+
+		if len(level) == 0 {
+			return nil, fmt.Errorf("Module dependency cycle: %v", findCycle(deps, placed))
+		}
+
+		for _, mod := range level {
+			placed[depName(mod)] = true
+		}
+		levels = append(levels, level)
+	}
+
+	return levels, nil
+}
+
+// Returns a cycle such as "a -> b -> a" among modules that are not placed
+func findCycle(deps map[string][]string, placed map[string]bool) string {
+	visiting := make(map[string]int) // Position in path, 0 if not on the path
+	path := make([]string, 0, 5)
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		if i := visiting[name]; i != 0 {
+			return append(path[i-1:], name)
+		}
+
+		path = append(path, name)
+		visiting[name] = len(path)
+
+		for _, dep := range deps[name] {
+			if placed[dep] {
+				continue
+			}
+
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+
+		path = path[:len(path)-1]
+		visiting[name] = 0
+
+		return nil
+	}
+
+	for name := range deps {
+		if placed[name] {
+			continue
+		}
+
+		if cycle := visit(name); cycle != nil {
+			return strings.Join(cycle, " -> ")
+		}
+	}
+
+	return "unknown"
+}
+
+// Returns the first module `mod` Requires that is not registered or failed
+func (self *ModManager) failedDep(mod *module.Module, errMap map[string]error) (string, error) {
+	for _, dep := range mod.Requires() {
+		_, m := self.find(dep)
+		if m == nil {
+			return dep, fmt.Errorf("Module %v is not registered", dep)
+		}
+
+		if err, ok := errMap[m.Name()]; ok {
+			return dep, err
+		}
+	}
+
+	return "", nil
+}
+
+// Returns the start levels of the registered modules. Register() rejects
+// cycles, so on error every module is returned in one level
+func (self *ModManager) levels() [][]*module.Module {
+	levels, err := startLevels(self.modules)
+	if err != nil {
+		self.core.Logger.Errorln(err)
+
+		return [][]*module.Module{self.modules}
+	}
+
+	return levels
+}
+
+// Calls `fn` on each level of modules in order, in parallel within a level
+func eachLevel(levels [][]*module.Module, fn func(mod *module.Module)) {
+	wg := new(sync.WaitGroup)
+
+	for _, level := range levels {
+		wg.Add(len(level))
+
+		for _, mod := range level {
+			go func(mod *module.Module) {
+				defer wg.Done()
+
+				fn(mod)
+			}(mod)
+		}
+
+		wg.Wait()
+	}
+}
+
+// Calls `fn` on each level of modules in order, in parallel within a level.
+// Modules already in errMap are skipped, as are modules whose requirements are
+// in errMap. Errors are logged to core and added to errMap
+func (self *ModManager) runLevels(levels [][]*module.Module, errMap map[string]error,
+	step string, fn func(mod *module.Module) error) {
+
+	errMut := new(sync.Mutex)
+
+	eachLevel(levels, func(mod *module.Module) {
+		errMut.Lock()
+		_, failed := errMap[mod.Name()]
+		dep, depErr := self.failedDep(mod, errMap)
+		errMut.Unlock()
+
+		if failed {
+			return
+		}
+
+		var err error
+		if dep != "" {
+			err = fmt.Errorf("Skipped, requires %v: %v", dep, depErr)
+			self.core.Logger.Warnf("%v.%v() skipped, requires %v: %v\n",
+				mod.Name(), step, dep, depErr)
+		} else if err = fn(mod); err == nil {
+			return
+		} else {
+			self.core.Logger.Errorf("%v.%v() error: %v\n", mod.Name(), step, err)
+		}
+
+		errMut.Lock()
+		errMap[mod.Name()] = err
+		errMut.Unlock()
+	})
+}
+
+// Returns a copy of `levels` in reverse order for stopping modules
+func reverseLevels(levels [][]*module.Module) [][]*module.Module {
+	reversed := make([][]*module.Module, len(levels))
+	for i, level := range levels {
+		reversed[len(levels)-1-i] = level
+	}
+
+	return reversed
+}
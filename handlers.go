@@ -1,41 +1,169 @@
 package irclib
 
 import (
+	"errors"
+	"time"
+
 	"github.com/crimsonvoid/irclib/module"
 	irc "github.com/fluffle/goirc/client"
 )
 
-func (self *ModManager) setupHandlers() {
-	// Identify to NickServ and join channels
-	self.Conn.HandleFunc(irc.CONNECTED, func(con *irc.Conn, line *irc.Line) {
-		con.Privmsg("NickServ", "IDENTIFY "+self.Conn.Config().Pass)
+func (self *ModManager) setupHandlers(s *Session) {
+	s.setupCaps()
+	s.setupSASL()
+	s.setupIdentity()
+	s.setupTracking()
 
-		self.mut.RLock()
-		defer self.mut.RUnlock()
+	// Identify to NickServ if SASL did not and join channels. This also runs
+	// after reconnecting
+	s.Conn.HandleFunc(irc.CONNECTED, func(con *irc.Conn, line *irc.Line) {
+		s.identify()
 
-		for _, ch := range self.Config.Chans {
+		for _, ch := range s.Chans() {
 			con.Join(ch)
 		}
 
+		s.reconnected()
+	})
+
+	// Reconnect if the connection drops while running
+	s.Conn.HandleFunc(irc.DISCONNECTED, func(con *irc.Conn, line *irc.Line) {
+		err := errors.New("Disconnected from " + s.Name)
+		s.failQueries(err)
+		s.resetBatches(err)
+		s.sendq.clear()
+		go s.startReconnect()
+	})
+
+	// Deliver each batch once goirc has dispatched the lines in it
+	s.Conn.HandleFunc("BATCH", func(con *irc.Conn, line *irc.Line) {
+		if b := s.endBatch(line); b != nil {
+			self.dispatchBatch(s, module.E_BATCH, b.Type, line, false, b)
+		}
 	})
 
-	// Iterate over EventList and register functions
-	events := module.RegisteredEvents()
-	for i := range events {
-		event := string(events[i])
+	self.syncEvents(s)
+}
+
+// Registers a handler for every event core or a registered module has
+// triggers for and removes handlers no module needs. E_ANY and E_RAW come from
+// the Session's wire instead and E_BATCH from the BATCH handler. Locked by
+// callee
+func (self *ModManager) syncEvents(s *Session) {
+	wanted := make(map[string]bool)
+	for _, mod := range append([]*module.Module{self.core}, self.modules...) {
+		for _, event := range mod.Events() {
+			wanted[string(event)] = true
+		}
+	}
+
+	s.mut.Lock()
+	s.wireEvents = make(map[module.Event]bool, 2)
+	for _, event := range []module.Event{module.E_ANY, module.E_RAW} {
+		if wanted[string(event)] {
+			s.wireEvents[event] = true
+			delete(wanted, string(event))
+		}
+	}
+	s.mut.Unlock()
+	delete(wanted, string(module.E_BATCH))
+
+	for event := range wanted {
+		if _, ok := s.events[event]; ok {
+			continue
+		}
 
-		self.Conn.HandleFunc(event, func(con *irc.Conn, line *irc.Line) {
-			go self.run(event, line)
+		event := event
+		s.events[event] = s.Conn.HandleFunc(event, func(con *irc.Conn, line *irc.Line) {
+			self.run(s, event, line)
 		})
 	}
+
+	for event, remover := range s.events {
+		if !wanted[event] {
+			remover.Remove()
+			delete(s.events, event)
+		}
+	}
+}
+
+func (self *ModManager) run(s *Session, event string, line *irc.Line) {
+	self.dispatch(s, module.Event(event), line.Text(), line, false)
+}
+
+// Called by Session.wire() with every raw line. Dispatches E_RAW for lines in
+// both directions and E_ANY for lines received if a module wants them
+func (self *ModManager) runWire(s *Session, raw string, sent bool) {
+	s.mut.RLock()
+	anyEvent, rawEvent := s.wireEvents[module.E_ANY], s.wireEvents[module.E_RAW]
+	s.mut.RUnlock()
+
+	if !rawEvent && !(anyEvent && !sent) {
+		return
+	}
+
+	line := irc.ParseLine(raw)
+	if line == nil {
+		return
+	}
+	if line.Time.IsZero() {
+		line.Time = time.Now()
+	}
+
+	if rawEvent {
+		self.dispatch(s, module.E_RAW, raw, line, sent)
+	}
+
+	if anyEvent && !sent {
+		self.dispatch(s, module.E_ANY, line.Text(), line.Copy(), false)
+	}
+}
+
+// Queues a line on core and every module. Handle() only blocks when a module's
+// queue is full and its overflow policy is module.Block. Lines echoed by
+// echo-message are only dispatched as E_RAW
+func (self *ModManager) dispatch(s *Session, event module.Event, trigger string, line *irc.Line, sent bool) {
+	self.dispatchBatch(s, event, trigger, line, sent, nil)
 }
 
-func (self *ModManager) run(event string, line *irc.Line) {
+// Dispatches a line with `batch` as its Message.Batch, otherwise the batch the
+// line arrived in
+func (self *ModManager) dispatchBatch(s *Session, event module.Event, trigger string, line *irc.Line, sent bool, batch *module.Batch) {
+	if event != module.E_RAW && s.isEcho(line) {
+		return
+	}
+
+	line = applyTags(line)
+
+	account := s.lineAccount(line, sent)
+
+	msg := &module.Message{
+		Line:    line,
+		Network: s.Name,
+		Client:  s,
+		Account: account,
+		Sent:    sent,
+	}
+
+	msg.Batch = batch
+	if batch == nil && !sent {
+		msg.Batch = s.lineBatch(line)
+	}
+
+	if !sent && line.Nick != "" && self.Config.Access.InGroups(msg.Source(), BlacklistGroup) != "" {
+		return
+	}
+
+	self.core.Handle(event, trigger, msg)
+
+	// Not held while handling so a blocked queue does not stall Unregister()
 	self.mut.RLock()
-	defer self.mut.RUnlock()
+	mods := make([]*module.Module, len(self.modules))
+	copy(mods, self.modules)
+	self.mut.RUnlock()
 
-	for _, mod := range self.modules {
+	for _, mod := range mods {
 		// Module should check if enabled, not handlers
-		go mod.Handle(module.Event(event), line.Text(), line)
+		mod.Handle(event, trigger, msg)
 	}
 }
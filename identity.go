@@ -0,0 +1,251 @@
+package irclib
+
+import (
+	"strings"
+
+	"github.com/crimsonvoid/irclib/module"
+	irc "github.com/fluffle/goirc/client"
+)
+
+// WHOX token used to recognise replies to our own account queries
+const whoxToken = "42"
+
+// Registers handlers that track the services account of each nick from
+// extended-join, account-notify and WHOX replies. Accounts are only kept while
+// the nick shares a channel with the bot; otherwise the nick may have been
+// taken by someone else without us seeing it
+func (self *Session) setupIdentity() {
+	// RPL_ISUPPORT; remember if the server supports WHOX and its mode types
+	self.Conn.HandleFunc("005", func(con *irc.Conn, line *irc.Line) {
+		self.mut.Lock()
+		defer self.mut.Unlock()
+
+		for _, token := range line.Args {
+			if strings.EqualFold(token, "WHOX") {
+				self.whox = true
+			}
+
+			self.modeTypes = self.modeTypes.WithISupport(token)
+		}
+	})
+
+	self.Conn.HandleFunc(irc.JOIN, func(con *irc.Conn, line *irc.Line) {
+		if len(line.Args) != 0 && !strings.EqualFold(line.Nick, self.Nick()) {
+			self.joined(line.Nick, line.Args[0])
+		}
+
+		// extended-join: JOIN #chan account :realname
+		if len(line.Args) == 3 {
+			self.setAccount(line.Nick, line.Args[1])
+		}
+
+		// Look up the accounts of everyone in a channel we joined
+		self.mut.RLock()
+		whox := self.whox
+		self.mut.RUnlock()
+
+		if whox && len(line.Args) != 0 && strings.EqualFold(line.Nick, self.Nick()) {
+			con.Raw("WHO " + line.Args[0] + " %tnfa," + whoxToken)
+		}
+	})
+
+	// account-notify: ACCOUNT account
+	self.Conn.HandleFunc("ACCOUNT", func(con *irc.Conn, line *irc.Line) {
+		if len(line.Args) != 0 {
+			self.setAccount(line.Nick, line.Args[0])
+		}
+	})
+
+	// RPL_WHOSPCRPL: me token nick flags account; flags start with G if away
+	self.Conn.HandleFunc("354", func(con *irc.Conn, line *irc.Line) {
+		if len(line.Args) == 5 && line.Args[1] == whoxToken {
+			self.setAway(line.Args[2], strings.HasPrefix(line.Args[3], "G"), "")
+			self.setAccount(line.Args[2], line.Args[4])
+		}
+	})
+
+	// RPL_NAMREPLY: me symbol #chan :nicks with prefixes, or nick!ident@host
+	// with userhost-in-names
+	self.Conn.HandleFunc("353", func(con *irc.Conn, line *irc.Line) {
+		if len(line.Args) != 4 {
+			return
+		}
+
+		for _, name := range strings.Fields(line.Args[3]) {
+			_, nick := self.ModeTypes().ParsePrefixes(name)
+			if i := strings.IndexByte(nick, '!'); i != -1 {
+				nick = nick[:i]
+			}
+
+			if !strings.EqualFold(nick, self.Nick()) {
+				self.joined(nick, line.Args[2])
+			}
+		}
+	})
+
+	self.Conn.HandleFunc(irc.PART, func(con *irc.Conn, line *irc.Line) {
+		if len(line.Args) != 0 {
+			self.left(line.Nick, line.Args[0])
+		}
+	})
+
+	self.Conn.HandleFunc(irc.KICK, func(con *irc.Conn, line *irc.Line) {
+		if len(line.Args) > 1 {
+			self.left(line.Args[1], line.Args[0])
+		}
+	})
+
+	self.Conn.HandleFunc(irc.NICK, func(con *irc.Conn, line *irc.Line) {
+		if len(line.Args) == 0 {
+			return
+		}
+
+		self.mut.Lock()
+		defer self.mut.Unlock()
+
+		old, nick := strings.ToLower(line.Nick), strings.ToLower(line.Args[0])
+		if chans, ok := self.common[old]; ok {
+			delete(self.common, old)
+			self.common[nick] = chans
+		}
+		if account, ok := self.accounts[old]; ok {
+			delete(self.accounts, old)
+			self.accounts[nick] = account
+		}
+	})
+
+	self.Conn.HandleFunc(irc.QUIT, func(con *irc.Conn, line *irc.Line) {
+		self.mut.Lock()
+		defer self.mut.Unlock()
+
+		nick := strings.ToLower(line.Nick)
+		delete(self.common, nick)
+		delete(self.accounts, nick)
+	})
+
+	self.Conn.HandleFunc(irc.DISCONNECTED, func(con *irc.Conn, line *irc.Line) {
+		self.mut.Lock()
+		self.accounts = make(map[string]string)
+		self.common = make(map[string]map[string]bool)
+		self.whox = false
+		self.modeTypes = module.DefaultModeTypes
+		self.mut.Unlock()
+	})
+}
+
+// Records that `nick` is in `channel` with the bot
+func (self *Session) joined(nick, channel string) {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	nick = strings.ToLower(nick)
+	if self.common[nick] == nil {
+		self.common[nick] = make(map[string]bool)
+	}
+	self.common[nick][strings.ToLower(channel)] = true
+}
+
+// Records that `nick` left `channel`, or that the bot did if `nick` is ours.
+// Nicks no longer sharing a channel with the bot lose their account
+func (self *Session) left(nick, channel string) {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	channel = strings.ToLower(channel)
+
+	if strings.EqualFold(nick, self.Nick()) {
+		for nick, chans := range self.common {
+			delete(chans, channel)
+			if len(chans) == 0 {
+				delete(self.common, nick)
+				delete(self.accounts, nick)
+			}
+		}
+
+		return
+	}
+
+	nick = strings.ToLower(nick)
+	if chans, ok := self.common[nick]; ok {
+		delete(chans, channel)
+		if len(chans) == 0 {
+			delete(self.common, nick)
+			delete(self.accounts, nick)
+		}
+	}
+}
+
+// Returns the services account of `nick` or an empty string if unknown. Only
+// nicks sharing a channel with the bot are known
+func (self *Session) Account(nick string) string {
+	self.mut.RLock()
+	defer self.mut.RUnlock()
+
+	nick = strings.ToLower(nick)
+	if len(self.common[nick]) == 0 {
+		return ""
+	}
+
+	return self.accounts[nick]
+}
+
+// Records the account of `nick`; "*", "0" and "" mean not logged in. Nicks
+// not sharing a channel with the bot are not recorded
+func (self *Session) setAccount(nick, account string) {
+	if nick == "" {
+		return
+	}
+
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	nick = strings.ToLower(nick)
+	if account = loggedIn(account); account == "" || len(self.common[nick]) == 0 {
+		delete(self.accounts, nick)
+	} else {
+		self.accounts[nick] = account
+	}
+}
+
+// Returns `account`, or an empty string for the "*" and "0" servers send when
+// logged out
+func loggedIn(account string) string {
+	if account == "*" || account == "0" {
+		return ""
+	}
+
+	return account
+}
+
+// Returns the account of the sender of a line being dispatched. goirc runs
+// the identity handlers for the same line concurrently, so an account the line
+// carries is recorded here first: account-tag, account-notify or
+// extended-join. With account-tag a line from a user without the tag means
+// they are logged out
+func (self *Session) lineAccount(line *irc.Line, sent bool) string {
+	if sent || line.Nick == "" {
+		return self.Account(line.Nick)
+	}
+
+	account, ok := line.Tags["account"]
+	switch {
+	case ok:
+	case line.Cmd == "ACCOUNT" && len(line.Args) != 0:
+		account, ok = line.Args[0], true
+	case line.Cmd == irc.JOIN && len(line.Args) == 3:
+		account, ok = line.Args[1], true
+	case line.Ident != "" && self.HasCap("account-tag"):
+		account, ok = "", true
+	}
+
+	if !ok {
+		return self.Account(line.Nick)
+	}
+
+	if line.Cmd == irc.JOIN && len(line.Args) != 0 && !strings.EqualFold(line.Nick, self.Nick()) {
+		self.joined(line.Nick, line.Args[0])
+	}
+	self.setAccount(line.Nick, account)
+
+	return loggedIn(account)
+}
@@ -0,0 +1,324 @@
+package irctest
+
+import (
+	"strings"
+)
+
+// Channel member prefixes, highest first, and the modes that grant them
+const (
+	memberPrefixes = "~&@%+"
+	memberModes    = "qaohv"
+)
+
+// Actions shared by clients and fake users. All are locked by callee
+
+// Returns the connections of real users sharing a channel with `u`, including
+// its own
+func (self *Server) peers(u *user) []*Conn {
+	seen := make(map[*Conn]bool)
+	conns := make([]*Conn, 0, 5)
+
+	add := func(c *Conn) {
+		if c != nil && c.registered && !seen[c] {
+			seen[c] = true
+			conns = append(conns, c)
+		}
+	}
+
+	add(u.conn)
+	nick := strings.ToLower(u.nick)
+	for _, ch := range self.channels {
+		if _, ok := ch.members[nick]; !ok {
+			continue
+		}
+
+		for member := range ch.members {
+			add(self.users[member].conn)
+		}
+	}
+
+	return conns
+}
+
+// Returns the connections of real users in a channel
+func (self *Server) members(ch *channel) []*Conn {
+	conns := make([]*Conn, 0, len(ch.members))
+	for member := range ch.members {
+		if c := self.users[member].conn; c != nil && c.registered {
+			conns = append(conns, c)
+		}
+	}
+
+	return conns
+}
+
+func (self *Server) join(u *user, name string) {
+	if !isChannel(name) {
+		if u.conn != nil {
+			u.conn.numeric("403", name, "No such channel")
+		}
+
+		return
+	}
+
+	ch, ok := self.channels[strings.ToLower(name)]
+	if !ok {
+		ch = &channel{name: name, modes: "nt", members: make(map[string]string)}
+		self.channels[strings.ToLower(name)] = ch
+	}
+
+	nick := strings.ToLower(u.nick)
+	if _, ok := ch.members[nick]; ok {
+		return
+	}
+
+	ch.members[nick] = ""
+	if len(ch.members) == 1 {
+		ch.members[nick] = "@"
+	}
+
+	account := u.account
+	if account == "" {
+		account = "*"
+	}
+
+	for _, c := range self.members(ch) {
+		if c.hasCap("extended-join") {
+			c.Send(":%v JOIN %v %v :%v", u.prefix(), ch.name, account, u.name)
+		} else {
+			c.Send(":%v JOIN %v", u.prefix(), ch.name)
+		}
+	}
+
+	if u.conn == nil {
+		return
+	}
+
+	if ch.topic != "" {
+		u.conn.numeric("332", ch.name, ch.topic)
+	}
+
+	multi := u.conn.hasCap("multi-prefix")
+	names := make([]string, 0, len(ch.members))
+	for member, prefix := range ch.members {
+		if !multi && len(prefix) > 1 {
+			prefix = prefix[:1]
+		}
+
+		names = append(names, prefix+self.users[member].nick)
+	}
+
+	u.conn.numeric("353", "=", ch.name, strings.Join(names, " "))
+	u.conn.numeric("366", ch.name, "End of /NAMES list")
+}
+
+// Returns false if `u` is not on the channel
+func (self *Server) part(u *user, name, msg string) bool {
+	ch, ok := self.channels[strings.ToLower(name)]
+	if !ok {
+		return false
+	}
+
+	nick := strings.ToLower(u.nick)
+	if _, ok := ch.members[nick]; !ok {
+		return false
+	}
+
+	for _, c := range self.members(ch) {
+		if msg == "" {
+			c.Send(":%v PART %v", u.prefix(), ch.name)
+		} else {
+			c.Send(":%v PART %v :%v", u.prefix(), ch.name, msg)
+		}
+	}
+
+	self.removeMember(ch, nick)
+
+	return true
+}
+
+func (self *Server) removeMember(ch *channel, nick string) {
+	delete(ch.members, nick)
+
+	if len(ch.members) == 0 {
+		delete(self.channels, strings.ToLower(ch.name))
+	}
+}
+
+// Sends a PRIVMSG or NOTICE. Returns false if the target does not exist
+func (self *Server) message(u *user, command, target, text string) bool {
+	recipients := make([]*Conn, 0, 5)
+
+	if isChannel(target) {
+		ch, ok := self.channels[strings.ToLower(target)]
+		if !ok {
+			return false
+		}
+
+		recipients = self.members(ch)
+	} else {
+		to, ok := self.users[strings.ToLower(target)]
+		if !ok {
+			return false
+		}
+
+		if to.conn != nil && to.conn.registered {
+			recipients = append(recipients, to.conn)
+		}
+
+		if u.conn != nil && u.conn != to.conn {
+			recipients = append(recipients, u.conn)
+		}
+	}
+
+	for _, c := range recipients {
+		if c == u.conn && !c.hasCap("echo-message") {
+			continue
+		}
+
+		c.Send(":%v %v %v :%v", u.prefix(), command, target, text)
+	}
+
+	return true
+}
+
+// Applies a channel mode change and relays it to the channel
+func (self *Server) mode(u *user, name, modes string, args ...string) {
+	ch, ok := self.channels[strings.ToLower(name)]
+	if !ok {
+		return
+	}
+
+	adding, next := true, 0
+	for _, m := range modes {
+		switch {
+		case m == '+' || m == '-':
+			adding = m == '+'
+		case strings.ContainsRune(memberModes, m):
+			if next >= len(args) {
+				continue
+			}
+
+			nick := strings.ToLower(args[next])
+			next++
+
+			prefix, ok := ch.members[nick]
+			if !ok {
+				continue
+			}
+
+			ch.members[nick] = setPrefix(prefix, memberPrefixes[strings.IndexRune(memberModes, m)], adding)
+		case m == 'b' || m == 'k' || (m == 'l' && adding):
+			next++
+		default:
+			if adding && !strings.ContainsRune(ch.modes, m) {
+				ch.modes += string(m)
+			} else if !adding {
+				ch.modes = strings.Replace(ch.modes, string(m), "", -1)
+			}
+		}
+	}
+
+	for _, c := range self.members(ch) {
+		c.Send(":%v MODE %v %v%v", u.prefix(), ch.name, modes, params(args))
+	}
+}
+
+// Adds or removes `p` keeping prefixes ordered highest first
+func setPrefix(prefixes string, p byte, adding bool) string {
+	out := ""
+	for i := 0; i < len(memberPrefixes); i++ {
+		c := memberPrefixes[i]
+		has := strings.IndexByte(prefixes, c) != -1
+		if c == p {
+			has = adding
+		}
+
+		if has {
+			out += string(c)
+		}
+	}
+
+	return out
+}
+
+func (self *Server) topic(u *user, name, topic string) {
+	ch, ok := self.channels[strings.ToLower(name)]
+	if !ok {
+		return
+	}
+
+	ch.topic = topic
+	for _, c := range self.members(ch) {
+		c.Send(":%v TOPIC %v :%v", u.prefix(), ch.name, topic)
+	}
+}
+
+// Returns false if the victim is not on the channel
+func (self *Server) kick(u *user, name, victim, reason string) bool {
+	ch, ok := self.channels[strings.ToLower(name)]
+	if !ok {
+		return false
+	}
+
+	nick := strings.ToLower(victim)
+	if _, ok := ch.members[nick]; !ok {
+		return false
+	}
+
+	for _, c := range self.members(ch) {
+		c.Send(":%v KICK %v %v :%v", u.prefix(), ch.name, self.users[nick].nick, reason)
+	}
+
+	self.removeMember(ch, nick)
+
+	return true
+}
+
+// Renames `u` and relays the change to everyone sharing a channel
+func (self *Server) nick(u *user, nick string) {
+	old, prefix := strings.ToLower(u.nick), u.prefix()
+
+	for _, c := range self.peers(u) {
+		c.Send(":%v NICK :%v", prefix, nick)
+	}
+
+	delete(self.users, old)
+	u.nick = nick
+	self.users[strings.ToLower(nick)] = u
+
+	for _, ch := range self.channels {
+		if p, ok := ch.members[old]; ok {
+			delete(ch.members, old)
+			ch.members[strings.ToLower(nick)] = p
+		}
+	}
+}
+
+// Removes `u` from every channel and relays QUIT to everyone sharing one
+func (self *Server) quit(u *user, reason string) {
+	nick := strings.ToLower(u.nick)
+
+	for _, c := range self.peers(u) {
+		if c != u.conn {
+			c.Send(":%v QUIT :%v", u.prefix(), reason)
+		}
+	}
+
+	for _, ch := range self.channels {
+		if _, ok := ch.members[nick]; ok {
+			self.removeMember(ch, nick)
+		}
+	}
+
+	delete(self.users, nick)
+}
+
+// Sends a line from `u` to peers with capability `cap`
+func (self *Server) notifyPeers(u *user, cap, format string, a ...interface{}) {
+	for _, c := range self.peers(u) {
+		if c != u.conn && c.hasCap(cap) {
+			c.Send(format, a...)
+		}
+	}
+}
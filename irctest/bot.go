@@ -0,0 +1,24 @@
+package irctest
+
+import (
+	"github.com/crimsonvoid/irclib"
+)
+
+// Returns a ServerInfo with a single network connecting to the server as
+// `nick` and joining `channels`. Tracking is on, reconnecting is off and lines
+// are sent without flood control
+func (self *Server) ServerInfo(nick string, channels ...string) *irclib.ServerInfo {
+	host, port := self.HostPort()
+
+	return &irclib.ServerInfo{
+		Nick:     nick,
+		Channels: channels,
+		Networks: []irclib.Network{{
+			Name:     "irctest",
+			Server:   host,
+			Port:     port,
+			Tracking: true,
+			Flood:    true,
+		}},
+	}
+}
@@ -0,0 +1,582 @@
+package irctest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Conn is a client connected to the fake server
+type Conn struct {
+	srv  *Server
+	conn net.Conn
+	out  chan string
+	done chan struct{}
+	once sync.Once
+
+	// Guarded by Server.mut
+	user       *user
+	pass       string
+	hasUser    bool
+	sawCap     bool     // Sent CAP before registering
+	capping    bool     // Registration is held until CAP END
+	registered bool     // Welcomed with 001
+	caps       []string // Capabilities acknowledged
+	saslMech   string   // Mechanism of an AUTHENTICATE in progress
+}
+
+// Sends a raw line to the client
+func (self *Conn) Send(format string, a ...interface{}) {
+	line := format
+	if len(a) != 0 {
+		line = fmt.Sprintf(format, a...)
+	}
+
+	select {
+	case self.out <- line:
+	case <-self.done:
+	}
+}
+
+// Writes queued lines so sends never block while the server is locked
+func (self *Conn) write() {
+	for {
+		select {
+		case line := <-self.out:
+			if _, err := self.conn.Write([]byte(line + "\r\n")); err != nil {
+				self.Close()
+
+				return
+			}
+		case <-self.done:
+			return
+		}
+	}
+}
+
+// Closes the connection
+func (self *Conn) Close() {
+	self.once.Do(func() {
+		close(self.done)
+		self.conn.Close()
+	})
+}
+
+// Returns the nick of the client or an empty string before NICK
+func (self *Conn) Nick() string {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	if self.user == nil {
+		return ""
+	}
+
+	return self.user.nick
+}
+
+// Returns the password sent with PASS
+func (self *Conn) Pass() string {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	return self.pass
+}
+
+// Returns true once the client is welcomed
+func (self *Conn) Registered() bool {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	return self.registered
+}
+
+// Returns the capabilities acknowledged for the client
+func (self *Conn) Caps() []string {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	caps := make([]string, len(self.caps))
+	copy(caps, self.caps)
+
+	return caps
+}
+
+// Returns the account the client logged in to with SASL
+func (self *Conn) Account() string {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	if self.user == nil {
+		return ""
+	}
+
+	return self.user.account
+}
+
+// Sends a numeric from the server. Locked by callee
+func (self *Conn) numeric(code string, args ...string) {
+	nick := "*"
+	if self.user != nil {
+		nick = self.user.nick
+	}
+
+	self.Send(":%v %v %v%v", ServerName, code, nick, params(args))
+}
+
+func (self *Conn) hasCap(name string) bool {
+	return inList(self.caps, name)
+}
+
+// Formats arguments as " a b :last"
+func params(args []string) string {
+	out := ""
+	for i, arg := range args {
+		if i == len(args)-1 && (arg == "" || strings.ContainsAny(arg, " :") || arg[0] == ':') {
+			out += " :" + arg
+		} else {
+			out += " " + arg
+		}
+	}
+
+	return out
+}
+
+func inList(list []string, target string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Built in handling of a line from a client
+func (self *Server) handle(c *Conn, line *Line) {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	switch line.Command {
+	case "PASS":
+		if len(line.Args) != 0 {
+			c.pass = line.Args[0]
+		}
+
+		return
+	case "CAP":
+		self.handleCap(c, line)
+
+		return
+	case "AUTHENTICATE":
+		self.handleAuthenticate(c, line)
+
+		return
+	case "NICK":
+		self.handleNick(c, line)
+
+		return
+	case "USER":
+		if len(line.Args) < 4 {
+			c.numeric("461", "USER", "Not enough parameters")
+
+			return
+		}
+
+		if c.user == nil {
+			c.user = &user{conn: c}
+		}
+		c.user.ident, c.user.name, c.user.host = line.Args[0], line.Text(), "127.0.0.1"
+		c.hasUser = true
+		self.tryRegister(c)
+
+		return
+	case "PING":
+		c.Send(":%v PONG %v :%v", ServerName, ServerName, line.Text())
+
+		return
+	case "PONG":
+		return
+	case "QUIT":
+		c.Send("ERROR :Closing link")
+		go self.drop(c, line.Text())
+
+		return
+	}
+
+	if !c.registered {
+		c.numeric("451", "You have not registered")
+
+		return
+	}
+
+	u := c.user
+	switch line.Command {
+	case "JOIN":
+		if len(line.Args) == 0 {
+			c.numeric("461", "JOIN", "Not enough parameters")
+
+			return
+		}
+
+		for _, name := range strings.Split(line.Args[0], ",") {
+			self.join(u, name)
+		}
+	case "PART":
+		if len(line.Args) == 0 {
+			c.numeric("461", "PART", "Not enough parameters")
+
+			return
+		}
+
+		msg := ""
+		if len(line.Args) > 1 {
+			msg = line.Args[1]
+		}
+
+		for _, name := range strings.Split(line.Args[0], ",") {
+			if !self.part(u, name, msg) {
+				c.numeric("442", name, "You're not on that channel")
+			}
+		}
+	case "PRIVMSG", "NOTICE":
+		if len(line.Args) < 2 {
+			c.numeric("412", "No text to send")
+
+			return
+		}
+
+		for _, target := range strings.Split(line.Args[0], ",") {
+			if !self.message(u, line.Command, target, line.Args[1]) && line.Command == "PRIVMSG" {
+				c.numeric("401", target, "No such nick/channel")
+			}
+		}
+	case "MODE":
+		self.handleMode(c, line)
+	case "TOPIC":
+		self.handleTopic(c, line)
+	case "KICK":
+		if len(line.Args) < 2 {
+			c.numeric("461", "KICK", "Not enough parameters")
+
+			return
+		}
+
+		reason := u.nick
+		if len(line.Args) > 2 {
+			reason = line.Args[2]
+		}
+
+		if !self.kick(u, line.Args[0], line.Args[1], reason) {
+			c.numeric("441", line.Args[1], line.Args[0], "They aren't on that channel")
+		}
+	case "WHO":
+		self.handleWho(c, line)
+	case "WHOIS":
+		self.handleWhois(c, line)
+	case "AWAY":
+		if len(line.Args) == 0 || line.Args[0] == "" {
+			c.numeric("305", "You are no longer marked as being away")
+		} else {
+			c.numeric("306", "You have been marked as being away")
+		}
+	default:
+		c.numeric("421", line.Command, "Unknown command")
+	}
+}
+
+func (self *Server) handleCap(c *Conn, line *Line) {
+	if len(line.Args) == 0 {
+		return
+	}
+
+	if !c.registered {
+		c.sawCap, c.capping = true, true
+	}
+
+	switch strings.ToUpper(line.Args[0]) {
+	case "LS":
+		c.Send(":%v CAP * LS :%v", ServerName, strings.Join(self.Caps, " "))
+	case "LIST":
+		c.Send(":%v CAP * LIST :%v", ServerName, strings.Join(c.caps, " "))
+	case "REQ":
+		req := strings.Fields(line.Text())
+		for _, name := range req {
+			if !inList(self.Caps, strings.TrimPrefix(name, "-")) {
+				c.Send(":%v CAP * NAK :%v", ServerName, line.Text())
+
+				return
+			}
+		}
+
+		for _, name := range req {
+			if strings.HasPrefix(name, "-") {
+				for i, v := range c.caps {
+					if strings.EqualFold(v, name[1:]) {
+						c.caps = append(c.caps[:i], c.caps[i+1:]...)
+						break
+					}
+				}
+			} else if !c.hasCap(name) {
+				c.caps = append(c.caps, name)
+			}
+		}
+
+		c.Send(":%v CAP * ACK :%v", ServerName, line.Text())
+	case "END":
+		c.capping = false
+		self.tryRegister(c)
+	}
+}
+
+// Accepts any SASL PLAIN credentials and any EXTERNAL attempt
+func (self *Server) handleAuthenticate(c *Conn, line *Line) {
+	if len(line.Args) == 0 {
+		return
+	}
+
+	if !c.hasCap("sasl") {
+		c.numeric("904", "SASL authentication failed")
+
+		return
+	}
+
+	arg := line.Args[0]
+	switch {
+	case arg == "*":
+		c.saslMech = ""
+		c.numeric("906", "SASL authentication aborted")
+	case c.saslMech == "":
+		mech := strings.ToUpper(arg)
+		if mech != "PLAIN" && mech != "EXTERNAL" {
+			c.numeric("908", "PLAIN,EXTERNAL", "are available SASL mechanisms")
+			c.numeric("904", "SASL authentication failed")
+
+			return
+		}
+
+		c.saslMech = mech
+		c.Send("AUTHENTICATE +")
+	default:
+		account := ""
+		if c.user != nil {
+			account = c.user.nick
+		}
+
+		if c.saslMech == "PLAIN" {
+			payload, err := base64.StdEncoding.DecodeString(arg)
+			parts := bytes.Split(payload, []byte{0})
+			if err != nil || len(parts) != 3 {
+				c.saslMech = ""
+				c.numeric("904", "SASL authentication failed")
+
+				return
+			}
+
+			account = string(parts[1])
+		}
+
+		c.saslMech = ""
+		if c.user == nil {
+			c.user = &user{conn: c}
+		}
+		c.user.account = account
+
+		c.numeric("900", c.user.prefix(), account, "You are now logged in as "+account)
+		c.numeric("903", "SASL authentication successful")
+	}
+}
+
+func (self *Server) handleNick(c *Conn, line *Line) {
+	if len(line.Args) == 0 {
+		c.numeric("431", "No nickname given")
+
+		return
+	}
+
+	nick := line.Args[0]
+	if other, ok := self.users[strings.ToLower(nick)]; ok && other.conn != c {
+		c.numeric("433", nick, "Nickname is already in use")
+
+		return
+	}
+
+	if c.registered {
+		self.nick(c.user, nick)
+
+		return
+	}
+
+	if c.user == nil {
+		c.user = &user{conn: c}
+	} else if c.user.nick != "" {
+		delete(self.users, strings.ToLower(c.user.nick))
+	}
+
+	c.user.nick = nick
+	self.users[strings.ToLower(nick)] = c.user
+	self.tryRegister(c)
+}
+
+// Welcomes the client once it sent NICK and USER and finished CAP. Without
+// CAP it waits RegisterDelay in case a CAP LS follows USER. Locked by callee
+func (self *Server) tryRegister(c *Conn) {
+	if c.registered || c.capping || !c.hasUser || c.user == nil || c.user.nick == "" {
+		return
+	}
+
+	if c.sawCap || self.RegisterDelay <= 0 {
+		self.register(c)
+
+		return
+	}
+
+	time.AfterFunc(self.RegisterDelay, func() {
+		self.mut.Lock()
+		defer self.mut.Unlock()
+
+		if !c.registered && !c.capping {
+			self.register(c)
+		}
+	})
+}
+
+// Locked by callee
+func (self *Server) register(c *Conn) {
+	c.registered = true
+
+	c.numeric("001", "Welcome to the irctest network "+c.user.prefix())
+	c.numeric("002", "Your host is "+ServerName)
+	c.numeric("003", "This server was created for testing")
+	c.numeric("004", ServerName, "irctest", "io", "biklmnopstv")
+	c.numeric("005", "CHANTYPES=#&", "PREFIX=(qaohv)~&@%+", "CHANMODES=b,k,l,imnpst",
+		"NETWORK=irctest", "are supported by this server")
+	c.numeric("422", "MOTD File is missing")
+}
+
+func (self *Server) handleMode(c *Conn, line *Line) {
+	if len(line.Args) == 0 {
+		c.numeric("461", "MODE", "Not enough parameters")
+
+		return
+	}
+
+	target := line.Args[0]
+	if !isChannel(target) {
+		if !strings.EqualFold(target, c.user.nick) {
+			c.numeric("502", "Can't change mode for other users")
+		} else if len(line.Args) == 1 {
+			c.numeric("221", "+i")
+		} else {
+			c.Send(":%v MODE %v :%v", c.user.nick, c.user.nick, line.Args[1])
+		}
+
+		return
+	}
+
+	ch, ok := self.channels[strings.ToLower(target)]
+	if !ok {
+		c.numeric("403", target, "No such channel")
+
+		return
+	}
+
+	if len(line.Args) == 1 {
+		c.numeric("324", ch.name, "+"+ch.modes)
+
+		return
+	}
+
+	self.mode(c.user, ch.name, line.Args[1], line.Args[2:]...)
+}
+
+func (self *Server) handleTopic(c *Conn, line *Line) {
+	if len(line.Args) == 0 {
+		c.numeric("461", "TOPIC", "Not enough parameters")
+
+		return
+	}
+
+	ch, ok := self.channels[strings.ToLower(line.Args[0])]
+	if !ok {
+		c.numeric("403", line.Args[0], "No such channel")
+
+		return
+	}
+
+	if len(line.Args) == 1 {
+		if ch.topic == "" {
+			c.numeric("331", ch.name, "No topic is set")
+		} else {
+			c.numeric("332", ch.name, ch.topic)
+		}
+
+		return
+	}
+
+	self.topic(c.user, ch.name, line.Args[1])
+}
+
+func (self *Server) handleWho(c *Conn, line *Line) {
+	mask := "*"
+	if len(line.Args) != 0 {
+		mask = line.Args[0]
+	}
+
+	if ch, ok := self.channels[strings.ToLower(mask)]; ok {
+		for nick, prefix := range ch.members {
+			u := self.users[nick]
+			c.numeric("352", ch.name, u.ident, u.host, ServerName, u.nick, "H"+prefix, "0 "+u.name)
+		}
+	} else if u, ok := self.users[strings.ToLower(mask)]; ok {
+		c.numeric("352", "*", u.ident, u.host, ServerName, u.nick, "H", "0 "+u.name)
+	}
+
+	c.numeric("315", mask, "End of /WHO list")
+}
+
+func (self *Server) handleWhois(c *Conn, line *Line) {
+	if len(line.Args) == 0 {
+		c.numeric("431", "No nickname given")
+
+		return
+	}
+
+	nick := line.Args[len(line.Args)-1]
+	u, ok := self.users[strings.ToLower(nick)]
+	if !ok {
+		c.numeric("401", nick, "No such nick/channel")
+		c.numeric("318", nick, "End of /WHOIS list")
+
+		return
+	}
+
+	c.numeric("311", u.nick, u.ident, u.host, "*", u.name)
+
+	chans := make([]string, 0, 5)
+	for _, ch := range self.channels {
+		if prefix, ok := ch.members[strings.ToLower(u.nick)]; ok {
+			if !c.hasCap("multi-prefix") && len(prefix) > 1 {
+				prefix = prefix[:1]
+			}
+
+			chans = append(chans, prefix+ch.name)
+		}
+	}
+	if len(chans) != 0 {
+		c.numeric("319", u.nick, strings.Join(chans, " "))
+	}
+
+	c.numeric("312", u.nick, ServerName, "irctest")
+	if u.account != "" {
+		c.numeric("330", u.nick, u.account, "is logged in as")
+	}
+	c.numeric("318", u.nick, "End of /WHOIS list")
+}
+
+func isChannel(target string) bool {
+	return target != "" && (target[0] == '#' || target[0] == '&')
+}
@@ -0,0 +1,98 @@
+package irctest
+
+import (
+	"strings"
+	"time"
+)
+
+// Line is a line sent to the fake server by a client
+type Line struct {
+	Raw     string    // Line without the trailing CRLF
+	Tags    string    // Unparsed message tags without the leading '@'
+	Prefix  string    // Source without the leading ':'
+	Command string    // Upper case command or numeric
+	Args    []string  // Parameters including the trailing one
+	Nick    string    // Nick of the client that sent the line
+	Time    time.Time // When the server read the line
+}
+
+// Returns the last argument or an empty string
+func (self *Line) Text() string {
+	if len(self.Args) == 0 {
+		return ""
+	}
+
+	return self.Args[len(self.Args)-1]
+}
+
+// Returns the first argument, which is the target of most commands
+func (self *Line) Target() string {
+	if len(self.Args) == 0 {
+		return ""
+	}
+
+	return self.Args[0]
+}
+
+// Returns true if the line is `command` and starts with arguments `args`.
+// Commands and arguments are compared ignoring case
+func (self *Line) Is(command string, args ...string) bool {
+	if !strings.EqualFold(self.Command, command) || len(self.Args) < len(args) {
+		return false
+	}
+
+	for i, arg := range args {
+		if !strings.EqualFold(self.Args[i], arg) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (self *Line) String() string {
+	return self.Raw
+}
+
+// Parses a raw IRC line. Returns nil for an empty line
+func ParseLine(raw string) *Line {
+	raw = strings.TrimRight(raw, "\r\n")
+	line := &Line{Raw: raw}
+
+	if strings.HasPrefix(raw, "@") {
+		i := strings.IndexByte(raw, ' ')
+		if i == -1 {
+			return nil
+		}
+
+		line.Tags, raw = raw[1:i], strings.TrimLeft(raw[i+1:], " ")
+	}
+
+	if strings.HasPrefix(raw, ":") {
+		i := strings.IndexByte(raw, ' ')
+		if i == -1 {
+			return nil
+		}
+
+		line.Prefix, raw = raw[1:i], strings.TrimLeft(raw[i+1:], " ")
+	}
+
+	trailing := ""
+	hasTrailing := false
+	if i := strings.Index(raw, " :"); i != -1 {
+		raw, trailing, hasTrailing = raw[:i], raw[i+2:], true
+	}
+
+	fields := strings.Fields(raw)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	line.Command = strings.ToUpper(fields[0])
+	line.Args = fields[1:]
+	if hasTrailing {
+		line.Args = append(line.Args, trailing)
+	}
+
+	return line
+}
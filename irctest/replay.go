@@ -0,0 +1,135 @@
+package irctest
+
+import (
+	"strings"
+	"time"
+
+	"github.com/crimsonvoid/irclib"
+)
+
+// Replays the records of `network` from a recording against the first client
+// to connect. The server stops answering on its own; received lines are sent
+// to the client as recorded and every line the bot sent must be sent again
+// before the next received line is replayed. Lines sent in between may come in
+// any order and extra lines are ignored. PING and PONG are skipped and a
+// redacted line only has to match up to the redacted argument
+func (self *Server) Replay(t TB, records []irclib.Record, network string) {
+	t.Helper()
+
+	self.mut.Lock()
+	self.Passive = true
+	self.mut.Unlock()
+
+	c := self.waitConn(t)
+	consumed := make(map[*Line]bool)
+	expected := make([]irclib.Record, 0, 5)
+
+	for _, record := range records {
+		if !strings.EqualFold(record.Network, network) || isPing(record.Line) {
+			continue
+		}
+
+		if record.Sent {
+			expected = append(expected, record)
+
+			continue
+		}
+
+		self.expectRecords(t, expected, consumed)
+		expected = expected[:0]
+
+		c.Send(record.Line)
+	}
+
+	self.expectRecords(t, expected, consumed)
+}
+
+// Loads a recording and replays it with Replay()
+func (self *Server) ReplayFile(t TB, fileName, network string) {
+	t.Helper()
+
+	records, err := irclib.ReadRecordFile(fileName)
+	if err != nil {
+		t.Fatalf("Unable to read recording %v: %v", fileName, err)
+	}
+
+	self.Replay(t, records, network)
+}
+
+// Waits for a line matching each record that was not matched before
+func (self *Server) expectRecords(t TB, records []irclib.Record, consumed map[*Line]bool) {
+	t.Helper()
+
+	for _, record := range records {
+		want := ParseLine(record.Line)
+		if want == nil {
+			continue
+		}
+
+		_, err := self.WaitFor(DefaultTimeout, func(line *Line) bool {
+			if consumed[line] || !matchRecord(want, line) {
+				return false
+			}
+
+			consumed[line] = true
+
+			return true
+		})
+		if err != nil {
+			t.Fatalf("Replay expected %q (recorded %v): %v",
+				record.Line, record.Time.Format(time.RFC3339Nano), err)
+		}
+
+		// WaitFor moves past the match; lines may arrive in any order
+		self.mut.Lock()
+		self.cursor = 0
+		self.mut.Unlock()
+	}
+}
+
+// Returns true if `line` matches a recorded line up to a redacted argument
+func matchRecord(want, line *Line) bool {
+	if want.Command != line.Command {
+		return false
+	}
+
+	for i, arg := range want.Args {
+		if strings.Contains(arg, irclib.Redacted) {
+			return true
+		}
+
+		if i >= len(line.Args) || line.Args[i] != arg {
+			return false
+		}
+	}
+
+	return len(want.Args) == len(line.Args)
+}
+
+func isPing(raw string) bool {
+	line := ParseLine(raw)
+
+	return line != nil && (line.Command == "PING" || line.Command == "PONG")
+}
+
+// Waits for a client to connect
+func (self *Server) waitConn(t TB) *Conn {
+	t.Helper()
+
+	deadline := time.Now().Add(DefaultTimeout)
+	for time.Now().Before(deadline) {
+		self.mut.Lock()
+		for c := range self.conns {
+			self.mut.Unlock()
+
+			return c
+		}
+		self.mut.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("No client connected to replay to")
+
+	return nil
+}
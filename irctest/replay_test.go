@@ -0,0 +1,43 @@
+package irctest_test
+
+import (
+	"testing"
+
+	"github.com/crimsonvoid/irclib"
+	"github.com/crimsonvoid/irclib/irctest"
+)
+
+// Every line goes through the Session's wire, so a recording replays as it
+// was seen. A second ModManager dials through its own wire once the first is
+// disconnected
+func TestReplayWire(t *testing.T) {
+	records := []irclib.Record{
+		{Network: "irctest", Sent: true, Line: "CAP LS 302"},
+		{Network: "irctest", Sent: true, Line: "NICK TestBot"},
+		{Network: "irctest", Line: ":irctest CAP * LS :"},
+		{Network: "irctest", Sent: true, Line: "CAP END"},
+		{Network: "irctest", Line: ":irctest 001 TestBot :Welcome to irctest"},
+		{Network: "irctest", Sent: true, Line: "JOIN #bots"},
+	}
+
+	for i := 0; i < 2; i++ {
+		srv, err := irctest.NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bot, err := irclib.NewManager(srv.ServerInfo("TestBot", "#bots"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if errMap := bot.Connect(); len(errMap) != 0 {
+			t.Fatalf("Connect: %v", errMap)
+		}
+
+		srv.Replay(t, records, "irctest")
+
+		bot.ForceDisconnect()
+		srv.Close()
+	}
+}
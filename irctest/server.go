@@ -0,0 +1,387 @@
+// Package irctest provides a scriptable in-process IRC server for testing
+// modules end to end. It speaks enough RFC 1459 and IRCv3 for a bot to
+// register, negotiate capabilities, join channels and relay PRIVMSG, NOTICE,
+// MODE, TOPIC and KICK, and records every line clients send so tests can
+// assert on what the bot did.
+//
+//	srv, err := irctest.NewServer()
+//	defer srv.Close()
+//
+//	bot, err := irclib.NewManager(srv.ServerInfo("MyBot", "#bots"))
+//	bot.Register(mod)
+//	bot.Connect()
+//
+//	srv.Expect(t, "JOIN", "#bots")
+//	srv.User("alice").Privmsg("#bots", "!ping")
+//	srv.Expect(t, "PRIVMSG", "#bots", "pong")
+package irctest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Name the fake server uses as its prefix
+const ServerName = "irc.test"
+
+// Default time Expect() waits for a line
+var DefaultTimeout = 5 * time.Second
+
+// Called for a line from a client instead of the built in handling
+type HandlerFunc func(c *Conn, line *Line)
+
+// Server is a fake IRC server. Real clients connect over loopback; fake users
+// created with User() only exist inside the server
+type Server struct {
+	Caps          []string      // Capabilities offered by CAP LS, e.g. "sasl"
+	RegisterDelay time.Duration // Time to wait for CAP after NICK and USER; 0 like a real ircd
+	Passive       bool          // Only record lines; Handle() handlers still run
+
+	ln       net.Listener
+	users    map[string]*user    // Lowered nick to user
+	channels map[string]*channel // Lowered name to channel
+	conns    map[*Conn]bool
+	handlers map[string]HandlerFunc
+
+	received []*Line
+	cursor   int           // Lines before cursor were matched by Expect()
+	notify   chan struct{} // Closed when a line is received
+	closed   bool
+
+	mut sync.Mutex
+}
+
+type user struct {
+	nick, ident, host, name string
+	account                 string
+	conn                    *Conn // nil for fake users
+}
+
+func (self *user) prefix() string {
+	return fmt.Sprintf("%v!%v@%v", self.nick, self.ident, self.host)
+}
+
+type channel struct {
+	name    string
+	topic   string
+	modes   string
+	members map[string]string // Lowered nick to prefixes such as "@"
+}
+
+// Returns a new Server listening on a random loopback port
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	srv := newServer()
+	srv.ln = ln
+
+	go srv.serve()
+
+	return srv, nil
+}
+
+func newServer() *Server {
+	return &Server{
+		users:    make(map[string]*user),
+		channels: make(map[string]*channel),
+		conns:    make(map[*Conn]bool),
+		handlers: make(map[string]HandlerFunc),
+		notify:   make(chan struct{}),
+	}
+}
+
+func (self *Server) serve() {
+	for {
+		c, err := self.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		go self.ServeConn(c)
+	}
+}
+
+// Returns the address the server listens on, or an empty string
+func (self *Server) Addr() string {
+	if self.ln == nil {
+		return ""
+	}
+
+	return self.ln.Addr().String()
+}
+
+// Returns the host and port the server listens on
+func (self *Server) HostPort() (string, int) {
+	if self.ln == nil {
+		return "", 0
+	}
+
+	addr := self.ln.Addr().(*net.TCPAddr)
+
+	return addr.IP.String(), addr.Port
+}
+
+// Stops listening and closes every connection
+func (self *Server) Close() error {
+	self.mut.Lock()
+	self.closed = true
+	conns := make([]*Conn, 0, len(self.conns))
+	for c := range self.conns {
+		conns = append(conns, c)
+	}
+	self.mut.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+
+	if self.ln != nil {
+		return self.ln.Close()
+	}
+
+	return nil
+}
+
+// Replaces the built in handling of `command` for lines from clients. Lines
+// are still recorded
+func (self *Server) Handle(command string, fn HandlerFunc) {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	self.handlers[strings.ToUpper(command)] = fn
+}
+
+// Sends a raw line to every registered client
+func (self *Server) Broadcast(format string, a ...interface{}) {
+	for _, c := range self.Conns() {
+		c.Send(format, a...)
+	}
+}
+
+// Returns the registered clients
+func (self *Server) Conns() []*Conn {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	conns := make([]*Conn, 0, len(self.conns))
+	for c := range self.conns {
+		if c.registered {
+			conns = append(conns, c)
+		}
+	}
+
+	return conns
+}
+
+// Returns the client connected as `nick` or nil
+func (self *Server) Conn(nick string) *Conn {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	if u, ok := self.users[strings.ToLower(nick)]; ok {
+		return u.conn
+	}
+
+	return nil
+}
+
+// Serves a client connection until it is closed
+func (self *Server) ServeConn(nc net.Conn) {
+	c := &Conn{
+		srv:  self,
+		conn: nc,
+		out:  make(chan string, 1024),
+		done: make(chan struct{}),
+	}
+	go c.write()
+
+	self.mut.Lock()
+	if self.closed {
+		self.mut.Unlock()
+		c.Close()
+
+		return
+	}
+	self.conns[c] = true
+	self.mut.Unlock()
+
+	defer self.drop(c, "Connection closed")
+
+	scanner := bufio.NewScanner(nc)
+	for scanner.Scan() {
+		line := ParseLine(scanner.Text())
+		if line == nil {
+			continue
+		}
+
+		line.Time = time.Now()
+		self.dispatch(c, line)
+	}
+}
+
+func (self *Server) dispatch(c *Conn, line *Line) {
+	self.mut.Lock()
+	if c.user != nil {
+		line.Nick = c.user.nick
+	}
+
+	self.received = append(self.received, line)
+	close(self.notify)
+	self.notify = make(chan struct{})
+
+	fn, ok := self.handlers[line.Command]
+	passive := self.Passive
+	self.mut.Unlock()
+
+	if ok {
+		fn(c, line)
+
+		return
+	}
+
+	if !passive {
+		self.handle(c, line)
+	}
+}
+
+// Removes a client, telling the channels it shared that it quit
+func (self *Server) drop(c *Conn, reason string) {
+	self.mut.Lock()
+	if !self.conns[c] {
+		self.mut.Unlock()
+
+		return
+	}
+	delete(self.conns, c)
+
+	if c.user != nil && c.registered {
+		self.quit(c.user, reason)
+	} else if c.user != nil {
+		delete(self.users, strings.ToLower(c.user.nick))
+	}
+	self.mut.Unlock()
+
+	c.Close()
+}
+
+// Returns every line received from clients
+func (self *Server) Received() []*Line {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	lines := make([]*Line, len(self.received))
+	copy(lines, self.received)
+
+	return lines
+}
+
+// Forgets received lines and resets where Expect() searches from
+func (self *Server) Clear() {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	self.received = self.received[:0]
+	self.cursor = 0
+}
+
+// Waits for a line matching `match` after the last matched line. Returns the
+// line and moves past it, or an error after `timeout`
+func (self *Server) WaitFor(timeout time.Duration, match func(*Line) bool) (*Line, error) {
+	deadline := time.After(timeout)
+
+	for {
+		self.mut.Lock()
+		for i := self.cursor; i < len(self.received); i++ {
+			if match(self.received[i]) {
+				line := self.received[i]
+				self.cursor = i + 1
+				self.mut.Unlock()
+
+				return line, nil
+			}
+		}
+		notify := self.notify
+		self.mut.Unlock()
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return nil, errors.New("Timed out waiting for a matching line")
+		}
+	}
+}
+
+// Fails the test unless a client sends `command` starting with `args` within
+// DefaultTimeout. Returns the matching line
+func (self *Server) Expect(t TB, command string, args ...string) *Line {
+	t.Helper()
+
+	line, err := self.WaitFor(DefaultTimeout, func(line *Line) bool {
+		return line.Is(command, args...)
+	})
+	if err != nil {
+		t.Fatalf("Expected %v %v: %v", command, strings.Join(args, " "), err)
+	}
+
+	return line
+}
+
+// Fails the test if a client sends `command` starting with `args` within `wait`
+func (self *Server) ExpectNone(t TB, wait time.Duration, command string, args ...string) {
+	t.Helper()
+
+	line, err := self.WaitFor(wait, func(line *Line) bool {
+		return line.Is(command, args...)
+	})
+	if err == nil {
+		t.Fatalf("Did not expect %v", line)
+	}
+}
+
+// Fails the test unless a client sends PRIVMSG `text` to `target`
+func (self *Server) ExpectPrivmsg(t TB, target, text string) *Line {
+	t.Helper()
+
+	return self.Expect(t, "PRIVMSG", target, text)
+}
+
+// Fails the test unless a client sends NOTICE `text` to `target`
+func (self *Server) ExpectNotice(t TB, target, text string) *Line {
+	t.Helper()
+
+	return self.Expect(t, "NOTICE", target, text)
+}
+
+// Waits until a client has registered as `nick`
+func (self *Server) WaitRegistered(t TB, nick string) *Conn {
+	t.Helper()
+
+	self.Expect(t, "NICK", nick)
+
+	deadline := time.Now().Add(DefaultTimeout)
+	for time.Now().Before(deadline) {
+		if c := self.Conn(nick); c != nil && c.Registered() {
+			return c
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("%v did not register", nick)
+
+	return nil
+}
+
+// TB is the subset of testing.TB used by the assertions
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+}
@@ -0,0 +1,40 @@
+package irctest_test
+
+import (
+	"testing"
+
+	"github.com/crimsonvoid/irclib"
+	"github.com/crimsonvoid/irclib/irctest"
+)
+
+// CAP LS has to reach the server before NICK and USER, otherwise a real ircd
+// registers the bot without waiting for SASL
+func TestRegisterOrder(t *testing.T) {
+	srv, err := irctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.Caps = []string{"sasl", "server-time"}
+
+	info := srv.ServerInfo("TestBot", "#bots")
+	info.Networks[0].SASL = irclib.SASL{Mechanism: "plain", User: "testbot", Pass: "secret"}
+
+	bot, err := irclib.NewManager(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errMap := bot.Connect(); len(errMap) != 0 {
+		t.Fatalf("Connect: %v", errMap)
+	}
+	defer bot.ForceDisconnect()
+
+	srv.Expect(t, "CAP", "LS")
+	srv.Expect(t, "NICK", "TestBot")
+	srv.Expect(t, "CAP", "REQ")
+	srv.Expect(t, "AUTHENTICATE", "PLAIN")
+	srv.Expect(t, "CAP", "END")
+	srv.Expect(t, "JOIN", "#bots")
+}
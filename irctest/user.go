@@ -0,0 +1,157 @@
+package irctest
+
+import (
+	"strings"
+)
+
+// User is a fake user that only exists inside the server. Its actions are
+// relayed to connected clients as if a real user sent them
+type User struct {
+	srv *Server
+	u   *user
+}
+
+// Returns the user with nick `nick`, creating a fake user if there is none
+func (self *Server) User(nick string) *User {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	u, ok := self.users[strings.ToLower(nick)]
+	if !ok {
+		u = &user{
+			nick:  nick,
+			ident: strings.ToLower(nick),
+			host:  "users." + ServerName,
+			name:  nick,
+		}
+		self.users[strings.ToLower(nick)] = u
+	}
+
+	return &User{self, u}
+}
+
+func (self *User) Nick() string {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	return self.u.nick
+}
+
+// Returns nick!ident@host
+func (self *User) Prefix() string {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	return self.u.prefix()
+}
+
+// Sets the user's ident and host
+func (self *User) SetHost(ident, host string) *User {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	self.u.ident, self.u.host = ident, host
+
+	return self
+}
+
+// Logs the user in to `account`, or out if empty, telling clients with
+// account-notify
+func (self *User) SetAccount(account string) *User {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	self.u.account = account
+
+	if account == "" {
+		account = "*"
+	}
+	self.srv.notifyPeers(self.u, "account-notify", ":%v ACCOUNT %v", self.u.prefix(), account)
+
+	return self
+}
+
+// Marks the user away, or back if `msg` is empty, telling clients with
+// away-notify
+func (self *User) Away(msg string) {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	if msg == "" {
+		self.srv.notifyPeers(self.u, "away-notify", ":%v AWAY", self.u.prefix())
+	} else {
+		self.srv.notifyPeers(self.u, "away-notify", ":%v AWAY :%v", self.u.prefix(), msg)
+	}
+}
+
+func (self *User) Join(channels ...string) {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	for _, ch := range channels {
+		self.srv.join(self.u, ch)
+	}
+}
+
+func (self *User) Part(channel, msg string) {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	self.srv.part(self.u, channel, msg)
+}
+
+func (self *User) Privmsg(target, text string) {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	self.srv.message(self.u, "PRIVMSG", target, text)
+}
+
+func (self *User) Notice(target, text string) {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	self.srv.message(self.u, "NOTICE", target, text)
+}
+
+// Sends a CTCP ACTION
+func (self *User) Action(target, text string) {
+	self.Privmsg(target, "\x01ACTION "+text+"\x01")
+}
+
+// Changes channel modes, e.g. Mode("#bots", "+o", "MyBot")
+func (self *User) Mode(channel, modes string, args ...string) {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	self.srv.mode(self.u, channel, modes, args...)
+}
+
+func (self *User) Topic(channel, topic string) {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	self.srv.topic(self.u, channel, topic)
+}
+
+func (self *User) Kick(channel, nick, reason string) {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	self.srv.kick(self.u, channel, nick, reason)
+}
+
+// Changes the user's nick
+func (self *User) Rename(nick string) {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	self.srv.nick(self.u, nick)
+}
+
+func (self *User) Quit(reason string) {
+	self.srv.mut.Lock()
+	defer self.srv.mut.Unlock()
+
+	self.srv.quit(self.u, reason)
+}
@@ -2,6 +2,8 @@ package irclib
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"strings"
@@ -11,76 +13,149 @@ import (
 	"github.com/crimsonvoid/console"
 	"github.com/crimsonvoid/console/styles"
 	"github.com/crimsonvoid/irclib/module"
-	irc "github.com/fluffle/goirc/client"
 )
 
 type ModManager struct {
-	Conn   *irc.Conn // IRC Connection
-	Config *BotInfo  // Bot config
+	Config *BotInfo // Bot config
 
-	core    *module.Module   // Core "master" module
-	modules []*module.Module // List of registered modules
-	mut     sync.RWMutex
-	running bool
+	sessions []*Session       // One connection per network
+	core     *module.Module   // Core "master" module
+	modules  []*module.Module // List of registered modules
+	unloaded []*module.Module // Modules removed with Unregister() to Load() again
+	mut      sync.RWMutex
+	running  bool
 
-	cons *console.Console // Console to get input
+	cons       *console.Console // Console to get input
+	configFile string           // File the config was read from, empty if none
+	sighup     chan os.Signal   // Reload on SIGHUP while running
+
+	recorder io.WriteCloser // Raw lines are recorded here when not nil
+	recFile  string
+	recMut   sync.Mutex
+
+	reloadMut sync.Mutex // Held by Reload()
+	stateMut  sync.Mutex // Held while writing the state file
 
 	Quit chan bool // Quit chan to block until a successful disconnect or force disconnect
 }
 
-// Returns a new ModManager configured with a TOML file.
+// Returns a new ModManager configured with a TOML file. StateFile defaults to
+// the config file with a ".state.toml" extension
 func New(fileName string) (*ModManager, error) {
-	servInfo := new(ServerInfo)
-	if _, err := toml.DecodeFile(fileName, servInfo); err != nil {
+	servInfo, err := readServerInfo(fileName)
+	if err != nil {
 		return nil, err
 	}
 
-	return NewManager(servInfo)
-}
+	if servInfo.StateFile == "" {
+		servInfo.StateFile = module.StateFileFor(fileName)
+	}
 
-// Create a new ModManager from a ServerInfo config
-func NewManager(serverInfo *ServerInfo) (*ModManager, error) {
-	ircCfg, err := serverInfo.configServer()
+	m, err := NewManager(servInfo)
 	if err != nil {
 		return nil, err
 	}
-	con := irc.Client(ircCfg)
 
-	// copy Chans and Accesss to allow serverInfo to be marked for GC
-	chans := make([]string, len(serverInfo.Channels))
-	copy(chans, serverInfo.Channels)
+	m.configFile = fileName
 
-	access := access{
-		list: make(map[string][]string, len(serverInfo.Access)),
+	return m, nil
+}
+
+// A ServerInfo with the single [network] table configs had before [[network]]
+type singleNetworkInfo struct {
+	ServerInfo
+	Networks Network `toml:"network"`
+}
+
+// Reads a ServerInfo from a TOML file. A single [network] table is accepted as
+// one [[network]]
+func readServerInfo(fileName string) (*ServerInfo, error) {
+	servInfo := new(ServerInfo)
+	_, err := toml.DecodeFile(fileName, servInfo)
+	if err == nil {
+		return servInfo, nil
 	}
 
-	for name, list := range serverInfo.Access {
-		users := list.Users
-		l := make([]string, len(users))
-		copy(l, users)
-		access.list[name] = l
+	single := new(singleNetworkInfo)
+	if _, singleErr := toml.DecodeFile(fileName, single); singleErr != nil {
+		return nil, err
 	}
 
+	single.ServerInfo.Networks = []Network{single.Networks}
+
+	return &single.ServerInfo, nil
+}
+
+// Create a new ModManager from a ServerInfo config. The access list saved in
+// ServerInfo.StateFile replaces ServerInfo.Access
+func NewManager(serverInfo *ServerInfo) (*ModManager, error) {
+	if len(serverInfo.Networks) == 0 {
+		return nil, errors.New("Specify a [[network]] in the config file")
+	}
+
+	if serverInfo.Commands != nil {
+		module.SetCmdPrefix(*serverInfo.Commands)
+	}
+
+	// copy Accesss to allow serverInfo to be marked for GC
+	access := new(access)
+	access.setConfig(serverInfo.Access)
+
 	m := &ModManager{
-		core:    newCore(),
-		modules: make([]*module.Module, 0, 5),
-		cons:    console.New(os.Stdin),
+		sessions: make([]*Session, 0, len(serverInfo.Networks)),
+		core:     newCore(),
+		modules:  make([]*module.Module, 0, 5),
+		cons:     console.New(os.Stdin),
 
-		Conn: con,
 		Config: &BotInfo{
-			Chans:  chans,
-			Access: access,
+			Access:    access,
+			StateFile: serverInfo.StateFile,
+			Record:    serverInfo.Record,
 		},
 		Quit: make(chan bool),
 	}
+
+	for i := range serverInfo.Networks {
+		s, err := newSession(m, serverInfo, &serverInfo.Networks[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if m.Session(s.Name) != nil {
+			return nil, fmt.Errorf("Network name %v is not unique", s.Name)
+		}
+
+		m.sessions = append(m.sessions, s)
+	}
+
+	if err := m.loadAccessState(); err != nil {
+		return nil, err
+	}
+
 	m.registerCoreCommands()
 	m.registerCommands()
 
+	if serverInfo.Modules != "" {
+		// One bad module file should not keep the others from loading
+		mods, errMap := LoadModuleDir(serverInfo.Modules)
+		for file, err := range errMap {
+			m.core.Logger.Errorf("Skipped module %v: %v\n", file, err)
+		}
+
+		for _, mod := range mods {
+			if err := m.Register(mod); err != nil {
+				m.core.Logger.Errorf("Skipped module %v: %v\n", mod.Name(), err)
+			}
+		}
+	}
+
 	return m, nil
 }
 
 // Registers a unique module; "core" is a reserved module name. If a module with
-// the same name is already registered an error is returned
+// the same name, ignoring case, is already registered or its Requires and
+// After make a cycle an error is returned. While running the module is started
+// immediately
 func (self *ModManager) Register(mod *module.Module) error {
 	name := mod.Name()
 
@@ -88,36 +163,95 @@ func (self *ModManager) Register(mod *module.Module) error {
 		return errors.New("Module is registered")
 	}
 
-	if name == self.core.Name() {
+	if strings.EqualFold(name, self.core.Name()) {
 		return errors.New("Module name is already registered")
 	}
 
 	self.mut.Lock()
-	defer self.mut.Unlock()
-
 	for _, v := range self.modules {
-		if v.Name() == name {
+		if strings.EqualFold(v.Name(), name) {
+			self.mut.Unlock()
+
 			return errors.New("Module name is already registered")
 		}
 	}
 
-	mod.Conn = self.Conn
+	mods := make([]*module.Module, len(self.modules), len(self.modules)+1)
+	copy(mods, self.modules)
+	if _, err := startLevels(append(mods, mod)); err != nil {
+		self.mut.Unlock()
+
+		return err
+	}
+
+	mod.Conn = self.sessions[0].Conn
+	mod.Client = self.client
+	mod.Access = self.Config.Access
 	self.modules = append(self.modules, mod)
+	running := self.running
+	self.mut.Unlock()
+
+	// Registered late; it stays registered if it fails so it can be restarted
+	if running {
+		return self.startModule(mod)
+	}
+
+	return nil
+}
+
+// Returns the Session for a network by name or nil if there is no such network
+func (self *ModManager) Session(network string) *Session {
+	network = strings.ToLower(network)
+
+	for _, s := range self.sessions {
+		if s.Name == network {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// Returns a copy of the list of Sessions, one per network
+func (self *ModManager) Sessions() []*Session {
+	sessions := make([]*Session, len(self.sessions))
+	copy(sessions, self.sessions)
+
+	return sessions
+}
+
+// Returns a copy of the list of registered modules
+func (self *ModManager) Modules() []*module.Module {
+	self.mut.RLock()
+	defer self.mut.RUnlock()
+
+	mods := make([]*module.Module, len(self.modules))
+	copy(mods, self.modules)
+
+	return mods
+}
+
+// Assigned to Module.Client; avoids returning a nil *Session as a non-nil interface
+func (self *ModManager) client(network string) module.Client {
+	if s := self.Session(network); s != nil {
+		return s
+	}
 
 	return nil
 }
 
-// Connect to IRC. If a registered module's PreStart() returns an error it does
-// not attempt to call Start(). A map of module names to error is returned if
-// there were any errors or nil if none. Errors are logged to the core module.
-// If there are errors in "core" from the map then Connect() failed
+// Connect to every network. Modules are started in dependency order, in
+// parallel when they do not depend on each other. If a registered module's
+// PreStart() returns an error it does not attempt to call Start(), nor on
+// modules that require it. A map of module names to error is
+// returned if there were any errors or nil if none. Errors are logged to the
+// core module. If there are errors in "core" from the map then Connect() failed
+// to connect to at least one network; it only gives up if every network failed
 func (self *ModManager) Connect() map[string]error {
 	self.mut.Lock()
 	defer self.mut.Unlock()
 
 	errMap := make(map[string]error)
-	errMut := new(sync.RWMutex)
-	wg := new(sync.WaitGroup)
 
 	if self.running {
 		errMap["core"] = errors.New("ModManager is already running")
@@ -125,80 +259,102 @@ func (self *ModManager) Connect() map[string]error {
 		return errMap
 	}
 
-	if self.Conn == nil || self.Config == nil {
+	if len(self.sessions) == 0 || self.Config == nil {
 		errMap["core"] = errors.New("Improperly configured ModManager")
 
 		return errMap
 	}
 
-	self.setupHandlers()
+	for _, s := range self.sessions {
+		s.addWire()
+		self.setupHandlers(s)
+	}
 
-	// module.PreStart()
-	wg.Add(len(self.modules))
+	if self.Config.Record != "" && self.Recording() == "" {
+		if err := self.StartRecording(self.Config.Record); err != nil {
+			self.core.Logger.Errorf("Unable to record to %v: %v\n", self.Config.Record, err)
+		}
+	}
+
+	levels, err := startLevels(self.modules)
+	if err != nil {
+		errMap["core"] = err
+
+		return errMap
+	}
+
+	// module.PreStart() in dependency order
 	for _, mod := range self.modules {
 		if mod.Conn == nil {
-			mod.Conn = self.Conn
+			mod.Conn = self.sessions[0].Conn
+			mod.Client = self.client
+			mod.Access = self.Config.Access
 		}
+	}
 
-		go func(mod *module.Module) {
-			defer wg.Done()
-
-			err := mod.PreStart()
-			if err == nil {
-				return
-			}
+	self.runLevels(levels, errMap, "PreStart", func(mod *module.Module) error {
+		return mod.PreStart()
+	})
 
-			self.core.Logger.Errorf("%v.PreStart() error: %v\n", mod.Name(), err)
+	// Connect to IRC
+	failed := make([]*Session, 0, len(self.sessions))
+	connErrs := make([]string, 0, len(self.sessions))
+	for _, s := range self.sessions {
+		if err := s.Conn.Connect(); err != nil {
+			self.core.Logger.Errorf("Error connecting to %v: %v\n", s.Name, err)
+
+			failed = append(failed, s)
+			connErrs = append(connErrs, fmt.Sprintf("%v: %v", s.Name, err))
+		}
+	}
 
-			errMut.Lock()
-			errMap[mod.Name()] = err
-			errMut.Unlock()
-		}(mod)
+	if len(connErrs) != 0 {
+		errMap["core"] = fmt.Errorf("Error connecting to %v", strings.Join(connErrs, ", "))
 	}
-	wg.Wait()
 
-	// Connect to IRC
-	if err := self.Conn.Connect(); err != nil {
-		self.core.Logger.Errorf("Error connecting: %v\n", err)
-		errMap["core"] = err
+	if len(failed) == len(self.sessions) {
+		for _, s := range self.sessions {
+			s.removeWire()
+		}
 
 		return errMap
 	}
 
-	// module.Start()
-	wg.Add(len(self.modules))
-	for _, mod := range self.modules {
-		go func(mod *module.Module) {
-			defer wg.Done()
-
-			errMut.RLock()
-			_, ok := errMap[mod.Name()]
-			errMut.RUnlock()
-			if ok {
-				return
-			}
+	// module.Start() in dependency order, skipping modules that failed or
+	// whose requirements failed
+	self.runLevels(levels, errMap, "Start", func(mod *module.Module) error {
+		if err := mod.Start(); err != nil {
+			return err
+		}
 
-			err := mod.Start()
-			if err == nil {
-				mod.Logger.Infof("%v.Start() successful!\n", mod.Name())
-				return
-			}
+		mod.Logger.Infof("%v.Start() successful!\n", mod.Name())
 
-			self.core.Logger.Errorf("%v.Start() error: %v\n", mod.Name(), err)
+		return nil
+	})
 
-			errMut.Lock()
-			errMap[mod.Name()] = err
-			errMut.Unlock()
-		}(mod)
+	// Modules may register triggers in Start()
+	for _, s := range self.sessions {
+		self.syncEvents(s)
 	}
-	wg.Wait()
 
 	self.running = true
+	self.watchSignals()
+
+	for _, s := range self.sessions {
+		if !s.Conn.Connected() {
+			continue
+		}
+
+		consLog.Println(styles.Green.Fg("%v connected to %v (%v)",
+			s.Conn.Config().Me.Nick, s.Name, s.Conn.Config().Server))
+		self.core.Logger.Infof("%v connected to %v (%v)\n",
+			s.Conn.Config().Me.Nick, s.Name, s.Conn.Config().Server)
+	}
 
-	consLog.Println(styles.Green.Fg("%v connected to %v",
-		self.Conn.Config().Me.Nick, self.Conn.Config().Server))
-	self.core.Logger.Infof("%v connected to %v\n",
-		self.Conn.Config().Me.Nick, self.Conn.Config().Server)
+	// Keep trying networks that failed if they reconnect
+	for _, s := range failed {
+		go s.startReconnect()
+	}
 
 	return errMap
 }
@@ -213,7 +369,6 @@ func (self *ModManager) Disconnect() map[string]error {
 
 	errMap := make(map[string]error)
 	errMut := new(sync.RWMutex)
-	wg := new(sync.WaitGroup)
 
 	if !self.running {
 		errMap["core"] = errors.New("ModManager is not running")
@@ -221,25 +376,20 @@ func (self *ModManager) Disconnect() map[string]error {
 		return errMap
 	}
 
-	wg.Add(len(self.modules))
-	for _, mod := range self.modules {
-		// TOOD - Modules can effect Conn, unsafe
-		go func(mod *module.Module) {
-			defer wg.Done()
-
-			err := mod.Exit()
-			if err == nil {
-				return
-			}
+	// Stop dependents before the modules they depend on
+	// TOOD - Modules can effect Conn, unsafe
+	eachLevel(reverseLevels(self.levels()), func(mod *module.Module) {
+		err := mod.Exit()
+		if err == nil {
+			return
+		}
 
-			self.core.Logger.Errorf("%v.Exit() error: %v\n", mod.Name(), err)
+		self.core.Logger.Errorf("%v.Exit() error: %v\n", mod.Name(), err)
 
-			errMut.Lock()
-			errMap[mod.Name()] = err
-			errMut.Unlock()
-		}(mod)
-	}
-	wg.Wait()
+		errMut.Lock()
+		errMap[mod.Name()] = err
+		errMut.Unlock()
+	})
 
 	if len(errMap) != 0 {
 		self.core.Logger.Infoln("Errors when attempting to disconnect")
@@ -261,9 +411,9 @@ func (self *ModManager) Disconnect() map[string]error {
 	}
 
 	self.cons.Close()
-	if self.Conn.Connected() {
-		self.Conn.Quit()
-	}
+	self.stopSignals()
+	self.quitSessions()
+	self.StopRecording()
 
 	self.running = false
 
@@ -273,30 +423,23 @@ func (self *ModManager) Disconnect() map[string]error {
 // Force Disconnect all modules, returning a map of modules to a list or errors
 func (self *ModManager) ForceDisconnect() map[string][]error {
 	self.mut.Lock()
-	defer self.mut.RUnlock()
+	defer self.mut.Unlock()
 
 	errMap := make(map[string][]error)
 	errMut := new(sync.Mutex)
-	wg := new(sync.WaitGroup)
-
-	wg.Add(len(self.modules))
-	for _, mod := range self.modules {
-		go func(mod *module.Module) {
-			defer wg.Done()
 
-			err := mod.ForceExit()
-			if err == nil {
-				return
-			}
+	eachLevel(reverseLevels(self.levels()), func(mod *module.Module) {
+		err := mod.ForceExit()
+		if err == nil {
+			return
+		}
 
-			self.core.Logger.Errorf("%v.ForceExit() error: %v\n", mod.Name(), err)
+		self.core.Logger.Errorf("%v.ForceExit() error: %v\n", mod.Name(), err)
 
-			errMut.Lock()
-			errMap[mod.Name()] = err
-			errMut.Unlock()
-		}(mod)
-	}
-	wg.Wait()
+		errMut.Lock()
+		errMap[mod.Name()] = err
+		errMut.Unlock()
+	})
 
 	if len(errMap) == 0 {
 		self.core.Logger.Infoln("Force disconnected without errors")
@@ -317,26 +460,45 @@ func (self *ModManager) ForceDisconnect() map[string][]error {
 	}
 
 	self.cons.Close()
+	self.stopSignals()
+	self.quitSessions()
+	self.StopRecording()
 
-	if self.Conn.Connected() {
-		self.Conn.Quit()
-	}
+	self.running = false
 
 	return errMap
 }
 
-// Force disconnect a module aggregating all errors and returning that list
-func (self *ModManager) ForceDisconnectModule(modName string) []error {
-	self.mut.RLock()
-	defer self.mut.RUnlock()
+// Stops pending reconnects and quits every connected network
+func (self *ModManager) quitSessions() {
+	for _, s := range self.sessions {
+		s.stopReconnect()
 
-	for _, mod := range self.modules {
-		if mod.Name() == modName {
-			return mod.ForceExit()
+		if s.Conn.Connected() {
+			s.Conn.Quit()
 		}
+
+		s.removeWire()
 	}
+}
 
-	return nil
+// Force disconnect a module aggregating all errors and returning that list. The
+// module is unloaded and can be registered again with Load()
+func (self *ModManager) ForceDisconnectModule(modName string) []error {
+	self.mut.Lock()
+	i, mod := self.find(modName)
+	if mod == nil {
+		self.mut.Unlock()
+
+		return nil
+	}
+
+	self.unload(i)
+	self.mut.Unlock()
+
+	// Not locked so handlers finishing and the Disconnect hook may call the
+	// ModManager
+	return mod.ForceExit()
 }
 
 func (self *ModManager) Running() bool {
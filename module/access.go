@@ -222,6 +222,22 @@ func (self *moduleConfig) InDenyed(target string) bool {
 	}
 }
 
+// Returns true if a mask in allowUser matches `src`; see Source.Match
+func (self *moduleConfig) MatchAllowed(src Source) bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return src.MatchAny(self.m.AllowUser)
+}
+
+// Returns true if a mask in denyUser matches `src`; see Source.Match
+func (self *moduleConfig) MatchDenyed(src Source) bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return src.MatchAny(self.m.DenyUser)
+}
+
 // Returns the length of allow(User|Chan)
 func (self *moduleConfig) LenAllowed(u userChan) int {
 	switch u {
@@ -1,6 +1,7 @@
 package module
 
 import (
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -20,6 +21,8 @@ func (self *Module) registerBaseCommands() {
 		self.registerLogs(),
 		self.registerLogs2(),
 		self.registerClearLogs(),
+		self.registerState(),
+		self.registerPanics(),
 	}
 
 	for _, err := range registerErrors {
@@ -37,7 +40,9 @@ func (self *Module) registerInfo() error {
 			color = styles.Red
 		}
 
-		strOut := ""
+		stats := self.DispatchStats()
+		strOut := fmt.Sprintf("\tWorkers: %v, queued: %v, dropped: %v\n",
+			stats.Workers, stats.Queued, stats.Dropped)
 
 		alwUsr, unAU := self.GetROAllowed(UC_User)
 		alwChn, unAC := self.GetROAllowed(UC_Chan)
@@ -103,6 +108,7 @@ func (self *Module) registerAdd() error {
 			return
 		}
 
+		self.saveState()
 		self.Logger.Infoln("Allowed", nick)
 		consLog.Println("Allowed", nick)
 	})
@@ -142,6 +148,7 @@ func (self *Module) registerRem() error {
 			return
 		}
 
+		self.saveState()
 		self.Logger.Infoln("Removed", nick)
 		consLog.Println("Removed", nick)
 	})
@@ -173,6 +180,7 @@ func (self *Module) registerClear() error {
 			msg = "deny" + msg
 		}
 
+		self.saveState()
 		self.Logger.Infof("Cleared %v list\n", msg)
 		consLog.Printf("Cleared %v list\n", msg)
 	})
@@ -301,3 +309,86 @@ func (self *Module) registerClearLogs() error {
 
 	return err
 }
+
+// Save allow/deny lists to the state file or reload the config and state files
+func (self *Module) registerState() error {
+	re := regexp.MustCompile(`^(?i)(?P<cmd>save|reload)$`)
+
+	err := self.Console.Register(re, func(s string) {
+		s = strings.ToLower(s)
+		groups, _ := matchGroups(re, s)
+
+		var (
+			err    error
+			status string
+		)
+
+		var changes []string
+
+		switch groups["cmd"] {
+		case "save":
+			err = self.SaveState()
+			status = "Saved state to " + self.StateFile()
+		default: // case "reload":
+			changes, err = self.Reload()
+			status = "Reloaded " + self.Name()
+		}
+
+		if err != nil {
+			self.Logger.Errorln("Module.registerState():", err.Error())
+			consLog.Println("Error:", err)
+
+			return
+		}
+
+		if len(changes) != 0 {
+			status += ": " + strings.Join(changes, ", ")
+		}
+
+		self.Logger.Infoln(status)
+		consLog.Println(status)
+	})
+
+	return err
+}
+
+// List panic counters or reset them, enabling disabled triggers
+func (self *Module) registerPanics() error {
+	re := regexp.MustCompile(`^(?i)panics(?: (?P<reset>reset)(?: (?P<trigger>.+))?)?$`)
+
+	err := self.Console.Register(re, func(s string) {
+		groups, _ := matchGroups(re, s)
+
+		if groups["reset"] != "" {
+			if !self.ResetPanics(groups["trigger"]) {
+				consLog.Println("No panics recorded for", groups["trigger"])
+
+				return
+			}
+
+			self.Logger.Infoln("Reset panics", groups["trigger"])
+			consLog.Println("Reset panics", groups["trigger"])
+
+			return
+		}
+
+		counts := self.Panics()
+		if len(counts) == 0 {
+			consLog.Println("No panics")
+
+			return
+		}
+
+		for _, p := range counts {
+			status := ""
+			if p.Disabled {
+				status = styles.Red.Fg(" disabled")
+			}
+
+			consLog.Printf("%v: %v panics, last %v: %v%v\n", p.Trigger, p.Count,
+				p.Last.Format("2006-01-02 15:04:05"), p.Value, status)
+		}
+	})
+
+	return err
+}
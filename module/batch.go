@@ -0,0 +1,18 @@
+package module
+
+import (
+	irc "github.com/fluffle/goirc/client"
+)
+
+// Batch of lines grouped by the server with IRCv3 BATCH, such as a netjoin or
+// chathistory playback
+type Batch struct {
+	Ref    string   // Reference the server tagged the lines with
+	Type   string   // Such as "chathistory", "netjoin" or "netsplit"
+	Params []string // Parameters after the type; the target for chathistory
+	Parent *Batch   // Batch this one is nested in, nil if outermost
+
+	// Lines in the batch and batches nested in it, in order. Only filled for
+	// E_BATCH and ChatHistory; nil on the lines of a batch
+	Lines []*irc.Line
+}
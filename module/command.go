@@ -0,0 +1,468 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type of a Command argument or flag
+type ArgType int
+
+const (
+	ArgString ArgType = iota // A single word or "quoted words"
+	ArgInt                   // A base 10 integer
+	ArgBool                  // Flags only; true when the flag is given
+	ArgRest                  // The rest of the line; last argument only
+)
+
+// Arg describes a positional argument or flag of a Command
+type Arg struct {
+	Name     string
+	Type     ArgType
+	Optional bool   // Positional arguments only; flags are always optional
+	Default  string // Value of an optional argument or flag when it is missing
+}
+
+// Command is a declarative IRC command triggered by a PRIVMSG starting with the
+// command prefix, highlighting the bot ("MyBot: cmd"), or a private message
+type Command struct {
+	Name    string   // Name the command is triggered with
+	Aliases []string // Other names the command is triggered with
+	Help    string   // Short description shown by help
+	Args    []Arg    // Positional arguments in order
+	Flags   []Arg    // Flags given as --name value, --name=value or --name for ArgBool
+	Group   string   // Access group required to use the command, empty allows everyone
+	Fn      func(*CommandEvent)
+}
+
+// Returns a usage string such as "!kick [--ban] <nick> [reason...]"
+func (self *Command) Usage() string {
+	usage := CmdPrefix().Prefix + self.Name
+
+	for _, flag := range self.Flags {
+		if flag.Type == ArgBool {
+			usage += fmt.Sprintf(" [--%v]", flag.Name)
+		} else {
+			usage += fmt.Sprintf(" [--%v %v]", flag.Name, flag.Name)
+		}
+	}
+
+	for _, arg := range self.Args {
+		name := arg.Name
+		if arg.Type == ArgRest {
+			name += "..."
+		}
+
+		if arg.Optional {
+			usage += fmt.Sprintf(" [%v]", name)
+		} else {
+			usage += fmt.Sprintf(" <%v>", name)
+		}
+	}
+
+	return usage
+}
+
+// Returns true if `name` is the command's name or one of its aliases
+func (self *Command) Is(name string) bool {
+	if strings.EqualFold(self.Name, name) {
+		return true
+	}
+
+	for _, alias := range self.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Checks a Command is well formed before it is registered
+func (self *Command) validate() error {
+	if self.Name == "" || self.Fn == nil {
+		return errors.New("Command needs a Name and Fn")
+	}
+
+	for i, arg := range self.Args {
+		switch {
+		case arg.Type == ArgBool:
+			return fmt.Errorf("Command %v: argument %v can not be ArgBool", self.Name, arg.Name)
+		case arg.Type == ArgRest && i != len(self.Args)-1:
+			return fmt.Errorf("Command %v: ArgRest %v must be the last argument", self.Name, arg.Name)
+		}
+	}
+
+	for _, flag := range self.Flags {
+		if flag.Type == ArgRest {
+			return fmt.Errorf("Command %v: flag %v can not be ArgRest", self.Name, flag.Name)
+		}
+	}
+
+	return nil
+}
+
+// CommandEvent is passed to a Command's Fn with the parsed arguments and flags
+type CommandEvent struct {
+	*Message
+
+	Command *Command // Command that was triggered
+	Name    string   // Name or alias the command was triggered with
+	ArgLine string   // Text after the command name
+
+	values map[string]string
+	ctx    context.Context
+}
+
+// Returns a Context cancelled when the module exits or the command times out
+func (self *CommandEvent) Context() context.Context {
+	return self.ctx
+}
+
+// Returns the value of an argument or flag, or its default if it was not given
+func (self *CommandEvent) String(name string) string {
+	return self.values[name]
+}
+
+// Returns the value of an ArgInt argument or flag
+func (self *CommandEvent) Int(name string) int {
+	i, _ := strconv.Atoi(self.values[name])
+
+	return i
+}
+
+// Returns true if an ArgBool flag was given
+func (self *CommandEvent) Bool(name string) bool {
+	return self.values[name] == "true"
+}
+
+// Returns true if an argument or flag was given or has a default
+func (self *CommandEvent) Has(name string) bool {
+	_, ok := self.values[name]
+
+	return ok
+}
+
+// Reply with Printf-style formatting to the channel or nick the command came from
+func (self *CommandEvent) Replyf(format string, a ...interface{}) {
+	self.Reply(fmt.Sprintf(format, a...))
+}
+
+// CommandPrefix configures how commands are recognised in PRIVMSGs
+type CommandPrefix struct {
+	Prefix    string // e.g. "!"; empty disables prefixed commands
+	Highlight bool   // Accept "MyBot: command" and "MyBot, command"
+	Private   bool   // Accept private messages without a prefix
+}
+
+var (
+	cmdPrefix    = CommandPrefix{"!", true, true}
+	cmdPrefixMut sync.RWMutex
+)
+
+// Sets how commands are recognised for every module
+func SetCmdPrefix(prefix CommandPrefix) {
+	cmdPrefixMut.Lock()
+	defer cmdPrefixMut.Unlock()
+
+	cmdPrefix = prefix
+}
+
+// Returns how commands are recognised
+func CmdPrefix() CommandPrefix {
+	cmdPrefixMut.RLock()
+	defer cmdPrefixMut.RUnlock()
+
+	return cmdPrefix
+}
+
+// Returns the text after the command prefix or false if `text` is not a command
+func stripPrefix(msg *Message, text string) (string, bool) {
+	prefix := CmdPrefix()
+
+	if prefix.Prefix != "" && strings.HasPrefix(text, prefix.Prefix) {
+		return text[len(prefix.Prefix):], true
+	}
+
+	if prefix.Highlight && msg.Client != nil {
+		nick := msg.Client.Nick()
+
+		if len(text) > len(nick) && strings.EqualFold(text[:len(nick)], nick) {
+			rest := text[len(nick):]
+
+			if rest[0] == ':' || rest[0] == ',' {
+				return strings.TrimSpace(rest[1:]), true
+			}
+		}
+	}
+
+	if prefix.Private && len(msg.Args) != 0 && !isChannel(msg.Args[0]) {
+		return text, true
+	}
+
+	return "", false
+}
+
+// Registers a Command. Returns an error if the command is malformed or its
+// name or an alias is already registered in the module
+func (self *Module) RegisterCommand(cmd *Command) error {
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+
+	self.cmdMut.Lock()
+	defer self.cmdMut.Unlock()
+
+	names := append([]string{cmd.Name}, cmd.Aliases...)
+	for _, c := range self.commands {
+		for _, name := range names {
+			if c.Is(name) {
+				return fmt.Errorf("Module.RegisterCommand(): %v is already registered", name)
+			}
+		}
+	}
+
+	appendEvent(E_PRIVMSG)
+	self.commands = append(self.commands, cmd)
+
+	return nil
+}
+
+// Unregisters a Command by name. Returns an error if it was not registered
+func (self *Module) UnregisterCommand(name string) error {
+	self.cmdMut.Lock()
+	defer self.cmdMut.Unlock()
+
+	for i, c := range self.commands {
+		if c.Name != name {
+			continue
+		}
+
+		self.commands = append(self.commands[:i], self.commands[i+1:]...)
+
+		return nil
+	}
+
+	return fmt.Errorf("Module.UnregisterCommand(): %v is not registered", name)
+}
+
+// Returns the registered Commands sorted by name
+func (self *Module) Commands() []*Command {
+	self.cmdMut.RLock()
+	cmds := make([]*Command, len(self.commands))
+	copy(cmds, self.commands)
+	self.cmdMut.RUnlock()
+
+	sort.Sort(byName(cmds))
+
+	return cmds
+}
+
+// Returns the Command triggered by name or alias `name`, or nil
+func (self *Module) FindCommand(name string) *Command {
+	self.cmdMut.RLock()
+	defer self.cmdMut.RUnlock()
+
+	for _, c := range self.commands {
+		if c.Is(name) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// Parses a PRIVMSG and calls the matching Command
+func (self *Module) handleCommand(msg *Message) {
+	text, ok := stripPrefix(msg, msg.Text())
+	if !ok {
+		return
+	}
+
+	name, line := text, ""
+	if i := strings.IndexAny(text, " \t"); i != -1 {
+		name, line = text[:i], strings.TrimSpace(text[i+1:])
+	}
+
+	cmd := self.FindCommand(name)
+	if cmd == nil {
+		return
+	}
+
+	if cmd.Group != "" && !self.checkAccess(msg, cmd.Group, CmdPrefix().Prefix+cmd.Name) {
+		return
+	}
+
+	values, err := parseArgs(cmd, line)
+	if err != nil {
+		msg.Reply(fmt.Sprintf("%v. Usage: %v", err, cmd.Usage()))
+
+		return
+	}
+
+	// Replies to restricted commands are usually admins managing the bot
+	reply := msg.Copy()
+	if cmd.Group != "" && reply.Client != nil {
+		reply.Client = reply.Client.WithPriority(PriorityHigh)
+	}
+
+	self.supervise("COMMAND "+cmd.Name, func(ctx context.Context) {
+		cmd.Fn(&CommandEvent{
+			Message: reply,
+			Command: cmd,
+			Name:    name,
+			ArgLine: line,
+			values:  values,
+			ctx:     ctx,
+		})
+	})
+}
+
+// Parses flags and positional arguments of `line` for `cmd`
+func parseArgs(cmd *Command, line string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, flag := range cmd.Flags {
+		if flag.Default != "" {
+			values[flag.Name] = flag.Default
+		}
+	}
+
+	words := splitWords(line)
+	positional := make([]string, 0, len(words))
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+
+		if word == "--" {
+			positional = append(positional, words[i+1:]...)
+			break
+		}
+
+		if !strings.HasPrefix(word, "--") || len(cmd.Flags) == 0 {
+			positional = append(positional, word)
+			continue
+		}
+
+		name, value, hasValue := word[2:], "", false
+		if j := strings.IndexByte(name, '='); j != -1 {
+			name, value, hasValue = name[:j], name[j+1:], true
+		}
+
+		flag := findArg(cmd.Flags, name)
+		if flag == nil {
+			return nil, fmt.Errorf("Unknown flag --%v", name)
+		}
+
+		if flag.Type == ArgBool {
+			values[flag.Name] = "true"
+			continue
+		}
+
+		if !hasValue {
+			if i+1 == len(words) {
+				return nil, fmt.Errorf("Flag --%v needs a value", name)
+			}
+
+			i++
+			value = words[i]
+		}
+
+		if err := checkArg(flag, value); err != nil {
+			return nil, err
+		}
+		values[flag.Name] = value
+	}
+
+	for i, arg := range cmd.Args {
+		if i >= len(positional) {
+			if !arg.Optional {
+				return nil, fmt.Errorf("Missing %v", arg.Name)
+			}
+
+			if arg.Default != "" {
+				values[arg.Name] = arg.Default
+			}
+
+			continue
+		}
+
+		value := positional[i]
+		if arg.Type == ArgRest {
+			value = strings.Join(positional[i:], " ")
+		}
+
+		if err := checkArg(&arg, value); err != nil {
+			return nil, err
+		}
+		values[arg.Name] = value
+	}
+
+	if len(positional) > len(cmd.Args) &&
+		(len(cmd.Args) == 0 || cmd.Args[len(cmd.Args)-1].Type != ArgRest) {
+
+		return nil, errors.New("Too many arguments")
+	}
+
+	return values, nil
+}
+
+func checkArg(arg *Arg, value string) error {
+	if arg.Type != ArgInt {
+		return nil
+	}
+
+	if _, err := strconv.Atoi(value); err != nil {
+		return fmt.Errorf("%v must be a number", arg.Name)
+	}
+
+	return nil
+}
+
+func findArg(args []Arg, name string) *Arg {
+	for i := range args {
+		if strings.EqualFold(args[i].Name, name) {
+			return &args[i]
+		}
+	}
+
+	return nil
+}
+
+// Splits `line` on whitespace keeping "double quoted" words together
+func splitWords(line string) []string {
+	words := make([]string, 0, 5)
+	word, quoted, inWord := "", false, false
+
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case (r == ' ' || r == '\t') && !quoted:
+			if inWord {
+				words = append(words, word)
+			}
+
+			word, inWord = "", false
+		default:
+			word += string(r)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word)
+	}
+
+	return words
+}
+
+type byName []*Command
+
+func (self byName) Len() int           { return len(self) }
+func (self byName) Less(i, j int) bool { return self[i].Name < self[j].Name }
+func (self byName) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
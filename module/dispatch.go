@@ -0,0 +1,234 @@
+package module
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// What Handle() does with a line when a module's queue is full
+const (
+	DropNewest = "dropnewest" // Discard the new line
+	DropOldest = "dropoldest" // Discard the oldest queued line to make room
+	Block      = "block"      // Wait for room, slowing reading from the network
+)
+
+// Defaults for ModuleInfo.Workers and ModuleInfo.QueueSize
+const (
+	defaultWorkers     = 4
+	defaultQueueSize   = 256
+	defaultExitTimeout = 5
+)
+
+// Queue and drop counts of a module's dispatcher
+type DispatchStats struct {
+	Workers int
+	Queued  int    // Lines waiting for a worker
+	Dropped uint64 // Lines discarded because the queue was full
+}
+
+// Runs a module's handlers on a fixed number of workers. Unordered workers
+// share one queue; ordered workers have a queue each and a line goes to the
+// worker picked by its network and target. Handler Contexts derive from ctx
+type dispatcher struct {
+	queues   []chan func()
+	overflow string
+	dropped  uint64 // Accessed atomically
+	quit     chan struct{}
+	workers  sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newDispatcher(workers, size int, overflow string, ordered bool) *dispatcher {
+	d := &dispatcher{
+		overflow: overflow,
+		quit:     make(chan struct{}),
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.workers.Add(workers)
+
+	if ordered {
+		d.queues = make([]chan func(), workers)
+		for i := range d.queues {
+			d.queues[i] = make(chan func(), size)
+			go d.work(d.queues[i])
+		}
+	} else {
+		d.queues = []chan func(){make(chan func(), size)}
+		for i := 0; i < workers; i++ {
+			go d.work(d.queues[0])
+		}
+	}
+
+	return d
+}
+
+func (self *dispatcher) work(queue chan func()) {
+	defer self.workers.Done()
+
+	for {
+		select {
+		case job := <-queue:
+			job()
+		case <-self.quit:
+			return
+		}
+	}
+}
+
+// Queues `job` on the queue for `key` following the overflow policy
+func (self *dispatcher) submit(key string, job func()) {
+	queue := self.queues[0]
+	if len(self.queues) > 1 {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		queue = self.queues[h.Sum32()%uint32(len(self.queues))]
+	}
+
+	for {
+		select {
+		case queue <- job:
+			return
+		default:
+		}
+
+		switch self.overflow {
+		case Block:
+			select {
+			case queue <- job:
+			case <-self.quit:
+			}
+
+			return
+		case DropOldest:
+			select {
+			case <-queue:
+				atomic.AddUint64(&self.dropped, 1)
+			default:
+			}
+		default: // case DropNewest:
+			atomic.AddUint64(&self.dropped, 1)
+
+			return
+		}
+	}
+}
+
+// Cancels handler Contexts and stops the workers after the lines they are
+// handling. Queued lines are dropped. Returns false if workers are still
+// running after `timeout`
+func (self *dispatcher) stop(timeout time.Duration) bool {
+	close(self.quit)
+	self.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		self.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (self *dispatcher) stats() DispatchStats {
+	stats := DispatchStats{Dropped: atomic.LoadUint64(&self.dropped)}
+	for _, queue := range self.queues {
+		stats.Queued += len(queue)
+	}
+
+	return stats
+}
+
+// Starts the dispatcher with the module's worker settings. Locked by callee
+func (self *Module) startDispatch() {
+	d := newDispatcher(self.m.Workers, self.m.QueueSize, self.m.Overflow, self.m.Ordered)
+
+	self.dispMut.Lock()
+	self.dispatch = d
+	self.dispMut.Unlock()
+}
+
+// Stops the dispatcher and waits up to ExitTimeout for running handlers; lines
+// arriving afterwards are not handled. Must not be called with mu held since
+// handlers may need it to return
+func (self *Module) stopDispatch() {
+	self.dispMut.Lock()
+	d := self.dispatch
+	self.dispatch = nil
+	self.dispMut.Unlock()
+
+	if d == nil {
+		return
+	}
+
+	self.mu.RLock()
+	timeout := time.Duration(self.m.ExitTimeout) * time.Second
+	self.mu.RUnlock()
+
+	if !d.stop(timeout) {
+		self.Logger.Warnf("Handlers of %v still running after %v\n", self.Name(), timeout)
+	}
+}
+
+// Returns a Context for a handler of trigger `key` that is cancelled when the
+// module exits or after the trigger's timeout. Returns nil if the module is
+// not running
+func (self *Module) handlerContext(key string) (context.Context, context.CancelFunc) {
+	self.dispMut.RLock()
+	d := self.dispatch
+	self.dispMut.RUnlock()
+
+	if d == nil || d.ctx.Err() != nil {
+		return nil, nil
+	}
+
+	if timeout := self.Timeout(key); timeout > 0 {
+		return context.WithTimeout(d.ctx, timeout)
+	}
+
+	return context.WithCancel(d.ctx)
+}
+
+// Returns the dispatcher's worker count, queue length and lines dropped
+func (self *Module) DispatchStats() DispatchStats {
+	self.mu.RLock()
+	workers := self.m.Workers
+	self.mu.RUnlock()
+
+	self.dispMut.RLock()
+	defer self.dispMut.RUnlock()
+
+	if self.dispatch == nil {
+		return DispatchStats{Workers: workers}
+	}
+
+	stats := self.dispatch.stats()
+	stats.Workers = workers
+
+	return stats
+}
+
+// Queues handling of `msg`. Returns false if the module is not running
+func (self *Module) enqueue(msg *Message, job func()) bool {
+	self.dispMut.RLock()
+	d := self.dispatch
+	self.dispMut.RUnlock()
+
+	if d == nil {
+		return false
+	}
+
+	d.submit(msg.Network+" "+strings.ToLower(msg.Target()), job)
+
+	return true
+}
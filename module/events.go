@@ -0,0 +1,442 @@
+package module
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Typed views of common lines. Each embeds the Message so the raw irc.Line and
+// Reply() stay available; fields such as Target and Text shadow the methods of
+// Message with the parsed value
+
+// Matches any text, for typed helpers that are not filtered by a trigger
+var anyText = regexp.MustCompile("")
+
+// A PRIVMSG or CTCP ACTION
+type PrivmsgEvent struct {
+	*Message
+
+	From      Source
+	Target    string // Channel, or the bot's nick if private
+	Text      string
+	IsAction  bool // Sent as a CTCP ACTION ("/me")
+	IsPrivate bool // Sent to the bot rather than a channel
+}
+
+type NoticeEvent struct {
+	*Message
+
+	From      Source // Nick is empty for server notices
+	Target    string
+	Text      string
+	IsPrivate bool
+}
+
+type JoinEvent struct {
+	*Message
+
+	From    Source
+	Channel string
+}
+
+type PartEvent struct {
+	*Message
+
+	From    Source
+	Channel string
+	Reason  string
+}
+
+type KickEvent struct {
+	*Message
+
+	From    Source // Who kicked
+	Channel string
+	Nick    string // Who was kicked
+	Reason  string
+}
+
+type QuitEvent struct {
+	*Message
+
+	From   Source
+	Reason string
+}
+
+type NickEvent struct {
+	*Message
+
+	From     Source // Source before the change
+	Old, New string
+}
+
+type TopicEvent struct {
+	*Message
+
+	From    Source
+	Channel string
+	Topic   string // Empty when the topic was cleared
+}
+
+type InviteEvent struct {
+	*Message
+
+	From    Source
+	Nick    string // Who was invited
+	Channel string
+}
+
+type ModeEvent struct {
+	*Message
+
+	From      Source // Nick is empty for modes set by a server
+	Target    string // Channel or nick
+	IsChannel bool
+	Changes   []ModeChange
+}
+
+// A single mode set or unset by a MODE line
+type ModeChange struct {
+	Add   bool
+	Mode  byte
+	Param string // Empty if the mode takes no parameter
+}
+
+// Returns the change as "+o nick" or "-m"
+func (self ModeChange) String() string {
+	sign := "-"
+	if self.Add {
+		sign = "+"
+	}
+
+	if self.Param == "" {
+		return sign + string(self.Mode)
+	}
+
+	return sign + string(self.Mode) + " " + self.Param
+}
+
+// Channel modes grouped by whether they take a parameter, as advertised by
+// the CHANMODES and PREFIX ISUPPORT tokens
+type ModeTypes struct {
+	List   string // Always take a parameter, such as bans
+	Param  string // Always take a parameter, such as the key
+	SetArg string // Take a parameter only when set, such as the limit
+	Prefix string // Member privileges, which take a nick
+
+	// Symbols shown before nicks in NAMES and WHO for each Prefix mode, in
+	// the same order
+	PrefixSymbols string
+}
+
+// Mode types used until a network advertises its own; common to most networks
+var DefaultModeTypes = ModeTypes{
+	List:   "beI",
+	Param:  "k",
+	SetArg: "lfj",
+	Prefix: "qaohv",
+
+	PrefixSymbols: "~&@%+",
+}
+
+// Returns the types updated from an ISUPPORT token such as "CHANMODES=b,k,l,imnt"
+// or "PREFIX=(ov)@+". Other tokens are ignored
+func (self ModeTypes) WithISupport(token string) ModeTypes {
+	i := strings.IndexByte(token, '=')
+	if i == -1 {
+		return self
+	}
+
+	name, value := strings.ToUpper(token[:i]), token[i+1:]
+	switch name {
+	case "CHANMODES":
+		groups := strings.Split(value, ",")
+		if len(groups) < 3 {
+			return self
+		}
+
+		self.List, self.Param, self.SetArg = groups[0], groups[1], groups[2]
+	case "PREFIX":
+		end := strings.IndexByte(value, ')')
+		if !strings.HasPrefix(value, "(") || end == -1 || len(value)-end-1 != end-1 {
+			return self
+		}
+
+		self.Prefix, self.PrefixSymbols = value[1:end], value[end+1:]
+	}
+
+	return self
+}
+
+// Returns true if mode `m` takes a parameter when set or unset
+func (self ModeTypes) takesParam(m byte, add bool) bool {
+	switch {
+	case strings.IndexByte(self.List+self.Param+self.Prefix, m) != -1:
+		return true
+	case strings.IndexByte(self.SetArg, m) != -1:
+		return add
+	}
+
+	return false
+}
+
+// Parses a mode string such as "+ov-b" with its parameters. User modes never
+// take parameters; channel modes are looked up in `types`
+func (self ModeTypes) Parse(modes string, params []string, channel bool) []ModeChange {
+	changes := make([]ModeChange, 0, len(modes))
+	add := true
+
+	for i := 0; i < len(modes); i++ {
+		switch m := modes[i]; m {
+		case '+':
+			add = true
+		case '-':
+			add = false
+		default:
+			change := ModeChange{Add: add, Mode: m}
+			if channel && self.takesParam(m, add) && len(params) != 0 {
+				change.Param, params = params[0], params[1:]
+			}
+
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
+// Returns the argument at `i` or an empty string
+func (self *Message) arg(i int) string {
+	if i < len(self.Args) {
+		return self.Args[i]
+	}
+
+	return ""
+}
+
+// Returns a PrivmsgEvent if `msg` is a PRIVMSG or ACTION, otherwise nil
+func AsPrivmsg(msg *Message) *PrivmsgEvent {
+	if msg.Cmd != string(E_PRIVMSG) && msg.Cmd != string(E_ACTION) {
+		return nil
+	}
+
+	return &PrivmsgEvent{
+		Message:   msg,
+		From:      msg.Source(),
+		Target:    msg.arg(0),
+		Text:      msg.arg(1),
+		IsAction:  msg.Cmd == string(E_ACTION),
+		IsPrivate: !isChannel(msg.arg(0)),
+	}
+}
+
+// Returns a NoticeEvent if `msg` is a NOTICE, otherwise nil
+func AsNotice(msg *Message) *NoticeEvent {
+	if msg.Cmd != string(E_NOTICE) {
+		return nil
+	}
+
+	return &NoticeEvent{
+		Message:   msg,
+		From:      msg.Source(),
+		Target:    msg.arg(0),
+		Text:      msg.arg(1),
+		IsPrivate: !isChannel(msg.arg(0)),
+	}
+}
+
+// Returns a JoinEvent if `msg` is a JOIN, otherwise nil
+func AsJoin(msg *Message) *JoinEvent {
+	if msg.Cmd != string(E_JOIN) {
+		return nil
+	}
+
+	return &JoinEvent{Message: msg, From: msg.Source(), Channel: msg.arg(0)}
+}
+
+// Returns a PartEvent if `msg` is a PART, otherwise nil
+func AsPart(msg *Message) *PartEvent {
+	if msg.Cmd != string(E_PART) {
+		return nil
+	}
+
+	return &PartEvent{Message: msg, From: msg.Source(), Channel: msg.arg(0), Reason: msg.arg(1)}
+}
+
+// Returns a KickEvent if `msg` is a KICK, otherwise nil
+func AsKick(msg *Message) *KickEvent {
+	if msg.Cmd != string(E_KICK) {
+		return nil
+	}
+
+	return &KickEvent{
+		Message: msg,
+		From:    msg.Source(),
+		Channel: msg.arg(0),
+		Nick:    msg.arg(1),
+		Reason:  msg.arg(2),
+	}
+}
+
+// Returns a QuitEvent if `msg` is a QUIT, otherwise nil
+func AsQuit(msg *Message) *QuitEvent {
+	if msg.Cmd != string(E_QUIT) {
+		return nil
+	}
+
+	return &QuitEvent{Message: msg, From: msg.Source(), Reason: msg.arg(0)}
+}
+
+// Returns a NickEvent if `msg` is a NICK, otherwise nil
+func AsNick(msg *Message) *NickEvent {
+	if msg.Cmd != string(E_NICK) {
+		return nil
+	}
+
+	return &NickEvent{Message: msg, From: msg.Source(), Old: msg.Nick, New: msg.arg(0)}
+}
+
+// Returns a TopicEvent if `msg` is a TOPIC, otherwise nil
+func AsTopic(msg *Message) *TopicEvent {
+	if msg.Cmd != string(E_TOPIC) {
+		return nil
+	}
+
+	return &TopicEvent{Message: msg, From: msg.Source(), Channel: msg.arg(0), Topic: msg.arg(1)}
+}
+
+// Returns an InviteEvent if `msg` is an INVITE, otherwise nil
+func AsInvite(msg *Message) *InviteEvent {
+	if msg.Cmd != string(E_INVITE) {
+		return nil
+	}
+
+	return &InviteEvent{Message: msg, From: msg.Source(), Nick: msg.arg(0), Channel: msg.arg(1)}
+}
+
+// Returns a ModeEvent if `msg` is a MODE, otherwise nil. Channel modes are
+// parsed with the mode types of the network, or DefaultModeTypes without one
+func AsMode(msg *Message) *ModeEvent {
+	if msg.Cmd != string(E_MODE) || len(msg.Args) < 2 {
+		return nil
+	}
+
+	target := msg.arg(0)
+	channel := isChannel(target)
+
+	types := DefaultModeTypes
+	if msg.Client != nil {
+		types = msg.Client.ModeTypes()
+	}
+
+	return &ModeEvent{
+		Message:   msg,
+		From:      msg.Source(),
+		Target:    target,
+		IsChannel: channel,
+		Changes:   types.Parse(msg.Args[1], msg.Args[2:], channel),
+	}
+}
+
+// Register a function called with a PrivmsgEvent for PRIVMSGs and ACTIONs whose
+// text matches trigger, a string or regexp.Regexp
+func (self *Module) OnPrivmsg(trigger interface{}, fn func(*PrivmsgEvent)) {
+	handler := func(msg *Message) {
+		fn(AsPrivmsg(msg))
+	}
+
+	self.On(E_PRIVMSG, trigger, handler)
+	self.On(E_ACTION, trigger, handler)
+}
+
+// Register a function called with a NoticeEvent for NOTICEs whose text matches
+// trigger, a string or regexp.Regexp
+func (self *Module) OnNotice(trigger interface{}, fn func(*NoticeEvent)) {
+	self.On(E_NOTICE, trigger, func(msg *Message) {
+		fn(AsNotice(msg))
+	})
+}
+
+// Register a function called with a JoinEvent for every JOIN
+func (self *Module) OnJoin(fn func(*JoinEvent)) {
+	self.On(E_JOIN, anyText, func(msg *Message) {
+		fn(AsJoin(msg))
+	})
+}
+
+// Register a function called with a PartEvent for every PART
+func (self *Module) OnPart(fn func(*PartEvent)) {
+	self.On(E_PART, anyText, func(msg *Message) {
+		fn(AsPart(msg))
+	})
+}
+
+// Register a function called with a KickEvent for every KICK
+func (self *Module) OnKick(fn func(*KickEvent)) {
+	self.On(E_KICK, anyText, func(msg *Message) {
+		fn(AsKick(msg))
+	})
+}
+
+// Register a function called with a QuitEvent for every QUIT
+func (self *Module) OnQuit(fn func(*QuitEvent)) {
+	self.On(E_QUIT, anyText, func(msg *Message) {
+		fn(AsQuit(msg))
+	})
+}
+
+// Register a function called with a NickEvent for every NICK
+func (self *Module) OnNick(fn func(*NickEvent)) {
+	self.On(E_NICK, anyText, func(msg *Message) {
+		fn(AsNick(msg))
+	})
+}
+
+// Register a function called with a TopicEvent for every TOPIC change
+func (self *Module) OnTopic(fn func(*TopicEvent)) {
+	self.On(E_TOPIC, anyText, func(msg *Message) {
+		fn(AsTopic(msg))
+	})
+}
+
+// Register a function called with an InviteEvent for every INVITE
+func (self *Module) OnInvite(fn func(*InviteEvent)) {
+	self.On(E_INVITE, anyText, func(msg *Message) {
+		fn(AsInvite(msg))
+	})
+}
+
+// Register a function called with a ModeEvent for every MODE
+func (self *Module) OnMode(fn func(*ModeEvent)) {
+	self.On(E_MODE, anyText, func(msg *Message) {
+		if ev := AsMode(msg); ev != nil {
+			fn(ev)
+		}
+	})
+}
+
+// A BATCH of lines once the server ends it
+type BatchEvent struct {
+	*Message
+
+	Batch *Batch
+}
+
+// Returns a BatchEvent if `msg` is an ended BATCH, otherwise nil
+func AsBatch(msg *Message) *BatchEvent {
+	if msg.Cmd != string(E_BATCH) || msg.Batch == nil {
+		return nil
+	}
+
+	return &BatchEvent{Message: msg, Batch: msg.Batch}
+}
+
+// Register a function called with a BatchEvent when a BATCH whose type
+// matches trigger, a string or regexp.Regexp, ends
+func (self *Module) OnBatch(trigger interface{}, fn func(*BatchEvent)) {
+	self.On(E_BATCH, trigger, func(msg *Message) {
+		if ev := AsBatch(msg); ev != nil {
+			fn(ev)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package module
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModeTypesParse(t *testing.T) {
+	tests := []struct {
+		modes   string
+		params  []string
+		channel bool
+		want    []ModeChange
+	}{
+		{"+o", []string{"nick"}, true, []ModeChange{{true, 'o', "nick"}}},
+		{"+ov-b", []string{"a", "b", "*!*@host"}, true,
+			[]ModeChange{{true, 'o', "a"}, {true, 'v', "b"}, {false, 'b', "*!*@host"}}},
+		{"+l-l", []string{"10"}, true, []ModeChange{{true, 'l', "10"}, {false, 'l', ""}}},
+		{"+k-k", []string{"key", "key"}, true, []ModeChange{{true, 'k', "key"}, {false, 'k', "key"}}},
+		{"+mnt", nil, true, []ModeChange{{true, 'm', ""}, {true, 'n', ""}, {true, 't', ""}}},
+		{"+o", nil, true, []ModeChange{{true, 'o', ""}}},
+		{"+iw-o", []string{"nick"}, false, []ModeChange{{true, 'i', ""}, {true, 'w', ""}, {false, 'o', ""}}},
+		{"", nil, true, []ModeChange{}},
+	}
+
+	for _, test := range tests {
+		got := DefaultModeTypes.Parse(test.modes, test.params, test.channel)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q, %q, %v) = %v, want %v", test.modes, test.params, test.channel, got, test.want)
+		}
+	}
+}
+
+func TestModeTypesWithISupport(t *testing.T) {
+	tests := []struct {
+		token string
+		want  ModeTypes
+	}{
+		{"CHANMODES=b,k,l,imnpst", ModeTypes{List: "b", Param: "k", SetArg: "l", Prefix: "qaohv", PrefixSymbols: "~&@%+"}},
+		{"PREFIX=(ov)@+", ModeTypes{List: "beI", Param: "k", SetArg: "lfj", Prefix: "ov", PrefixSymbols: "@+"}},
+		{"PREFIX=", DefaultModeTypes},
+		{"PREFIX=(ov)@", DefaultModeTypes},
+		{"CHANMODES=b", DefaultModeTypes},
+		{"WHOX", DefaultModeTypes},
+	}
+
+	for _, test := range tests {
+		if got := DefaultModeTypes.WithISupport(test.token); got != test.want {
+			t.Errorf("WithISupport(%q) = %+v, want %+v", test.token, got, test.want)
+		}
+	}
+
+	types := DefaultModeTypes.WithISupport("CHANMODES=b,k,l,imnt").WithISupport("PREFIX=(ov)@+")
+	want := []ModeChange{{true, 'h', ""}, {true, 'o', "a"}, {true, 'j', ""}}
+	if got := types.Parse("+hoj", []string{"a", "b"}, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse with ISUPPORT = %v, want %v", got, want)
+	}
+}
+
+func TestModeTypesParsePrefixes(t *testing.T) {
+	ov := DefaultModeTypes.WithISupport("PREFIX=(ov)@+")
+	bang := DefaultModeTypes.WithISupport("PREFIX=(Yqohv)!~@%+")
+
+	tests := []struct {
+		types ModeTypes
+		name  string
+		privs Privs
+		nick  string
+	}{
+		{DefaultModeTypes, "~&@%+alice", Privs{true, true, true, true, true}, "alice"},
+		{DefaultModeTypes, "alice", Privs{}, "alice"},
+		{ov, "@+alice", Privs{Op: true, Voice: true}, "alice"},
+		{ov, "~alice", Privs{}, "~alice"},
+		{bang, "!@bob", Privs{Op: true}, "bob"},
+		{bang, "~bob", Privs{Owner: true}, "bob"},
+	}
+
+	for _, test := range tests {
+		privs, nick := test.types.ParsePrefixes(test.name)
+		if privs != test.privs || nick != test.nick {
+			t.Errorf("ParsePrefixes(%q) with %q = %+v, %q, want %+v, %q",
+				test.name, test.types.PrefixSymbols, privs, nick, test.privs, test.nick)
+		}
+	}
+}
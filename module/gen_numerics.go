@@ -0,0 +1,93 @@
+//go:build ignore
+// +build ignore
+
+// Generates numerics.go from numerics.txt. Run with "go generate" in module/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var lineRe = regexp.MustCompile(`^(\d{3})\s+((?:RPL|ERR)_[A-Z0-9_]+)$`)
+
+type numeric struct {
+	code, name string
+}
+
+func main() {
+	f, err := os.Open("numerics.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	numerics := make([]numeric, 0, 200)
+	names := make(map[string]bool)
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		m := lineRe.FindStringSubmatch(line)
+		if m == nil {
+			log.Fatalf("numerics.txt:%v: malformed line %q", n, line)
+		}
+
+		if names[m[2]] {
+			log.Fatalf("numerics.txt:%v: duplicate name %v", n, m[2])
+		}
+		names[m[2]] = true
+
+		numerics = append(numerics, numeric{m[1], m[2]})
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintln(buf, "// Code generated by gen_numerics.go from numerics.txt; DO NOT EDIT.")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "package module")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "// Numeric replies to trigger on")
+	fmt.Fprintln(buf, "const (")
+	for _, num := range numerics {
+		fmt.Fprintf(buf, "\t%v Event = %q\n", num.name, num.code)
+	}
+	fmt.Fprintln(buf, ")")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "// Name of each numeric; the first listed when a code has several")
+	fmt.Fprintln(buf, "var numericNames = map[Event]string{")
+	seen := make(map[string]bool)
+	for _, num := range numerics {
+		if seen[num.code] {
+			continue
+		}
+		seen[num.code] = true
+
+		fmt.Fprintf(buf, "\t%v: %q,\n", num.name, num.name)
+	}
+	fmt.Fprintln(buf, "}")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile("numerics.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
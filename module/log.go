@@ -90,6 +90,11 @@ func (me *Logger) SetPrefix(prefix string) {
 	me.logger.SetPrefix(prefix)
 }
 
+// Sends further output to `out`. log.Logger serializes this with writes
+func (me *Logger) setOutput(out io.Writer) {
+	me.logger.SetOutput(out)
+}
+
 // Prefix returns the current logger prefix
 func (me *Logger) Prefix() string {
 	me.mut.RLock()
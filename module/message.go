@@ -0,0 +1,138 @@
+package module
+
+import (
+	irc "github.com/fluffle/goirc/client"
+)
+
+// Client sends to a single IRC network. It is implemented by the library and
+// handed to handlers with every Message so replies go out on the network the
+// line arrived on. State is empty unless tracking is enabled for the network
+type Client interface {
+	State
+	Queries
+
+	Network() string // Name of the network
+	Nick() string    // Current nick on the network
+	Connected() bool
+
+	Caps() []string          // IRCv3 capabilities the server granted
+	HasCap(name string) bool // Capability `name` was granted
+	ModeTypes() ModeTypes    // Channel modes the server advertised
+
+	Raw(line string)
+	Privmsg(target, msg string)
+	Notice(target, msg string)
+	Action(target, msg string)
+	Join(channel string, key ...string)
+	Part(channel string, message ...string)
+	Kick(channel, nick string, message ...string)
+	Topic(channel string, topic ...string)
+
+	// Send with client-only tags such as "+draft/reply". Without message-tags
+	// the tags are dropped and TagMsg sends nothing and returns false
+	PrivmsgTags(target, msg string, tags map[string]string)
+	NoticeTags(target, msg string, tags map[string]string)
+	TagMsg(target string, tags map[string]string) bool
+
+	// Returns a Client whose lines are queued at `priority`. Lines are
+	// PriorityNormal unless sent through one
+	WithPriority(priority Priority) Client
+}
+
+// Priority of lines in a network's send queue. Higher priorities are sent
+// first; lines of the same priority take turns by target
+type Priority int
+
+const (
+	PriorityHigh   Priority = iota // Replies to restricted commands and PONG
+	PriorityNormal                 // Everything else
+	PriorityLow                    // Bulk output such as announcements
+)
+
+// Message is an irc.Line tagged with the network it arrived on
+type Message struct {
+	*irc.Line
+
+	Network string // Name of the network the line arrived on
+	Client  Client // Handle to reply on the network the line arrived on
+	Account string // Services account of the sender, empty if unknown
+	Sent    bool   // Sent by the bot; only E_RAW lines are
+	Batch   *Batch // BATCH the line arrived in, nil for live lines
+}
+
+// Returns a deep copy of the Message; the Client is shared
+func (self *Message) Copy() *Message {
+	return &Message{
+		Line:    self.Line.Copy(),
+		Network: self.Network,
+		Client:  self.Client,
+		Account: self.Account,
+		Sent:    self.Sent,
+		Batch:   self.Batch,
+	}
+}
+
+// Returns the value of IRCv3 message tag `name` and whether the line has it
+func (self *Message) Tag(name string) (string, bool) {
+	value, ok := self.Tags[name]
+
+	return value, ok
+}
+
+// Returns true if the line is history replayed by the server, such as
+// chathistory or ZNC playback, rather than live traffic
+func (self *Message) IsHistory() bool {
+	for b := self.Batch; b != nil; b = b.Parent {
+		if b.Type == "chathistory" || b.Type == "draft/chathistory" || b.Type == "znc.in/playback" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the msgid tag the server gave the line, or an empty string
+func (self *Message) MsgID() string {
+	return self.Tags["msgid"]
+}
+
+// Reply like Reply(), marking it as a reply to this line with +draft/reply
+// when the line has a msgid
+func (self *Message) ReplyTo(text string) {
+	if msgid := self.MsgID(); msgid != "" {
+		self.Client.PrivmsgTags(self.Target(), text, map[string]string{"+draft/reply": msgid})
+
+		return
+	}
+
+	self.Reply(text)
+}
+
+// React to this line with `reaction`, such as an emoji, using +draft/react.
+// Returns false if the line has no msgid or the server does not support tags
+func (self *Message) React(reaction string) bool {
+	msgid := self.MsgID()
+	if msgid == "" {
+		return false
+	}
+
+	return self.Client.TagMsg(self.Target(), map[string]string{
+		"+draft/reply": msgid,
+		"+draft/react": reaction,
+	})
+}
+
+// Returns who sent the line
+func (self *Message) Source() Source {
+	return Source{
+		Nick:    self.Nick,
+		Ident:   self.Ident,
+		Host:    self.Host,
+		Account: self.Account,
+	}
+}
+
+// Reply to the channel the line was sent to, or to the nick if it was private
+func (self *Message) Reply(text string) {
+	self.Client.Privmsg(self.Target(), text)
+}
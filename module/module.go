@@ -4,6 +4,7 @@ package module
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"github.com/BurntSushi/toml"
 	"os"
@@ -16,7 +17,7 @@ import (
 
 type re struct {
 	trigger *regexp.Regexp
-	fn      func(*irc.Line)
+	fn      func(context.Context, *Message)
 }
 
 type eventTrigger struct {
@@ -28,65 +29,109 @@ type eventTrigger struct {
 type Module struct {
 	moduleConfig
 
-	// IRC Connection. Conn is not assigned until it is registered
+	// IRC Connection. Conn is not assigned until it is registered. With more
+	// than one network Conn is the first network; reply with Message.Client
 	Conn *irc.Conn
 
+	// Returns the Client for a network by name or nil if there is no such
+	// network. Client is not assigned until it is registered
+	Client func(network string) Client
+
+	// Access groups of the library. Access is not assigned until it is registered
+	Access Access
+
 	// Connect functions to call before or after IRC connection
 	// Disconnect is called after disconnected from IRC
 	// Errors are logged to to the module Logger
 	Preconnect, Connected, Disconnect func() error
 
+	// Reconnecting is called when the connection to a network is lost and the
+	// library is about to reconnect; Reconnected once the server has welcomed
+	// us again. Start() is not called again after a reconnect
+	Reconnecting, Reconnected func(network string) error
+
 	running bool
 	file    *os.File      // File to write logs to
 	bufFile *bufio.Writer // Buffered writer of Module.file
 
-	stTriggers   map[eventTrigger][]func(*irc.Line)
+	stTriggers   map[eventTrigger][]func(context.Context, *Message)
 	reTriggers   map[Event][]*re
 	stMut, reMut sync.RWMutex
 
+	commands []*Command
+	cmdMut   sync.RWMutex
+
+	panics   map[string]*PanicCount // Keyed by trigger
+	panicMut sync.Mutex
+
+	dispatch *dispatcher // Runs handlers while the module is running
+	dispMut  sync.RWMutex
+
 	Console *Console // Console handler; commands are triggered with ":moduleName <command>"
 	Logger  *Logger
+
+	configFile string // File the module was read from, empty if not read from a file
 }
 
 // Read a TOML file and return a configured Module. Errors indicate a failure to
-// parse the file or an incomplete configuration
+// parse the file or an incomplete configuration. StateFile defaults to the
+// config file with a ".state.toml" extension
 func New(configFile string) (*Module, error) {
+	modInfo, err := readModuleInfo(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	mod, err := modInfo.NewModule()
+	if err != nil {
+		return nil, err
+	}
+
+	mod.configFile = configFile
+
+	return mod, nil
+}
+
+// Reads a ModuleInfo from a TOML file, defaulting StateFile
+func readModuleInfo(configFile string) (*ModuleInfo, error) {
 	modInfo := new(ModuleInfo)
 	if _, err := toml.DecodeFile(configFile, modInfo); err != nil {
 		return nil, err
 	}
 
-	return modInfo.NewModule()
+	if modInfo.StateFile == "" {
+		modInfo.StateFile = StateFileFor(configFile)
+	}
+
+	return modInfo, nil
 }
 
 // Returns a configured Module from ModuleInfo. ModuleInfo.Name and
-// ModuleInfo.Description can not be an empty string
+// ModuleInfo.Description can not be an empty string. Allow/deny lists saved in
+// ModuleInfo.StateFile replace those in ModuleInfo
 func (self *ModuleInfo) NewModule() (*Module, error) {
 	if self.Name == "" || self.Description == "" {
 		return nil, fmt.Errorf("Improperly configured ModuleInfo")
 	}
 
-	if self.LogDir == "" {
-		self.LogDir = logDir
-	} else if self.LogDir[len(self.LogDir)-1:] != "/" {
-		self.LogDir = self.LogDir + "/"
-	}
-
-	toLowerSlice(self.AllowUser)
-	toLowerSlice(self.DenyUser)
-	toLowerSlice(self.AllowChan)
-	toLowerSlice(self.DenyChan)
+	self.normalize()
 
 	mod := &Module{
 		moduleConfig: moduleConfig{
-			m: *self,
+			m:      *self,
+			config: listsOf(self),
 		},
 
-		stTriggers: make(map[eventTrigger][]func(*irc.Line)),
+		stTriggers: make(map[eventTrigger][]func(context.Context, *Message)),
 		reTriggers: make(map[Event][]*re),
+		panics:     make(map[string]*PanicCount),
 		Console:    newConsole(),
 	}
 
+	if err := mod.LoadState(); err != nil {
+		return nil, err
+	}
+
 	if err := mod.createLogger(); err != nil {
 		return nil, err
 	}
@@ -142,6 +187,7 @@ func (self *Module) Start() error {
 	}
 
 	self.running = true
+	self.startDispatch()
 
 	if self.Connected == nil {
 		return nil
@@ -154,10 +200,51 @@ func (self *Module) Start() error {
 	return nil
 }
 
-// Calls Disconnect(), cleans up, and exits. Errors returned by Disconnect() are
-// logged and Exit() continues. If there is an error at any other point the error
-// is returned and should be assumed that cleanup did not complete.
+// Calls Reconnecting() if applicable. This is exported for use by library and
+// most likely does not need to be called by the user. Errors returned by
+// Reconnecting() are logged and returned
+func (self *Module) PreReconnect(network string) error {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	if !self.running || self.Reconnecting == nil {
+		return nil
+	}
+
+	err := self.Reconnecting(network)
+	if err != nil {
+		self.Logger.Errorln(err)
+	}
+
+	return err
+}
+
+// Calls Reconnected() if applicable. This is exported for use by library and
+// most likely does not need to be called by the user. Errors returned by
+// Reconnected() are logged and returned
+func (self *Module) PostReconnect(network string) error {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	if !self.running || self.Reconnected == nil {
+		return nil
+	}
+
+	err := self.Reconnected(network)
+	if err != nil {
+		self.Logger.Errorln(err)
+	}
+
+	return err
+}
+
+// Cancels handler Contexts and waits up to ExitTimeout for handlers to return,
+// then calls Disconnect(), cleans up, and exits. Errors returned by Disconnect()
+// are logged and Exit() continues. If there is an error at any other point the
+// error is returned and should be assumed that cleanup did not complete.
 func (self *Module) Exit() error {
+	self.stopDispatch()
+
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
@@ -187,10 +274,12 @@ func (self *Module) Exit() error {
 	return nil
 }
 
-// Calls Disconnect(), cleans up, and exits. ForceExit() continues on errors,
-// which are aggregated and returned in a slice. If there are no errors `nil`
-// is returned
+// Like Exit(), cancels and waits for handlers, then calls Disconnect(), cleans
+// up, and exits. ForceExit() continues on errors, which are aggregated and
+// returned in a slice. If there are no errors `nil` is returned
 func (self *Module) ForceExit() []error {
+	self.stopDispatch()
+
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
@@ -228,7 +317,26 @@ func (self *Module) ForceExit() []error {
 	return errs
 }
 
+// Register a function that is called with the raw irc.Line when an Event of
+// eventMode is triggered and trigger, a string or regexp.Regexp, matches
 func (self *Module) Register(eventMode Event, trigger interface{}, fn func(*irc.Line)) {
+	self.On(eventMode, trigger, func(msg *Message) {
+		fn(msg.Line)
+	})
+}
+
+// Register a function that is called with a Message when an Event of eventMode
+// is triggered and trigger, a string or regexp.Regexp, matches. Reply through
+// Message.Client to answer on the network the line arrived on
+func (self *Module) On(eventMode Event, trigger interface{}, fn func(*Message)) {
+	self.OnContext(eventMode, trigger, func(ctx context.Context, msg *Message) {
+		fn(msg)
+	})
+}
+
+// Register a function like On() that is also passed a Context. It is cancelled
+// when the module exits or the trigger's timeout passes; see ModuleInfo.Timeout
+func (self *Module) OnContext(eventMode Event, trigger interface{}, fn func(context.Context, *Message)) {
 	switch trigger.(type) {
 	case string:
 		self.registerString(eventMode, trigger.(string), fn)
@@ -242,7 +350,7 @@ func (self *Module) Register(eventMode Event, trigger interface{}, fn func(*irc.
 
 // Register a function that is called when an Event of eventMode is triggered and
 // trigger equals input. trigger is lowered before registering.
-func (self *Module) registerString(eventMode Event, trigger string, fn func(*irc.Line)) {
+func (self *Module) registerString(eventMode Event, trigger string, fn func(context.Context, *Message)) {
 	trigger = strings.ToLower(trigger)
 	eventMode = Event(strings.ToUpper(string(eventMode)))
 
@@ -259,7 +367,7 @@ func (self *Module) registerString(eventMode Event, trigger string, fn func(*irc
 
 // Register a function that is called when an Event of eventMode is triggered and
 // trigger equals input.
-func (self *Module) registerRegexp(eventMode Event, trigger *regexp.Regexp, fn func(*irc.Line)) {
+func (self *Module) registerRegexp(eventMode Event, trigger *regexp.Regexp, fn func(context.Context, *Message)) {
 	eventMode = Event(strings.ToUpper(string(eventMode)))
 
 	appendEvent(eventMode)
@@ -273,84 +381,154 @@ func (self *Module) registerRegexp(eventMode Event, trigger *regexp.Regexp, fn f
 	self.reTriggers[eventMode] = fns
 }
 
-// Handles triggers if module is enabled and user/chan is allowed. This is mainly
-// exported for use by library and should not have to be called by the user
-func (self *Module) Handle(eventMode Event, trigger string, line *irc.Line) {
+// Returns true if the module is enabled and the user and channel of `msg` are
+// allowed. Users are matched by nick, hostmask or account; see Source.Match
+func (self *Module) Allowed(msg *Message) bool {
+	src := msg.Source()
+
 	// Filtered by: denyUser, allowUser, denyChan, allowChan
-	if !self.Enabled() ||
-		self.InDenyed(line.Nick) ||
+	return self.Enabled() &&
+		!self.MatchDenyed(src) &&
 		// Empty allowUser list => allow all
-		(self.LenAllowed(UC_User) != 0 && !self.InAllowed(line.Nick)) ||
-		self.InDenyed(line.Target()) ||
+		(self.LenAllowed(UC_User) == 0 || self.MatchAllowed(src)) &&
+		!self.InDenyed(msg.Target()) &&
 		// Empty denyChan list => allow all
-		(self.LenAllowed(UC_Chan) != 0 && !self.InAllowed(line.Target())) {
+		(self.LenAllowed(UC_Chan) == 0 || self.InAllowed(msg.Target()))
+}
 
+// Handles triggers if module is enabled and user/chan is allowed. Handlers run
+// on the module's workers; see ModuleInfo.Workers. This is mainly exported for
+// use by library and should not have to be called by the user
+func (self *Module) Handle(eventMode Event, trigger string, msg *Message) {
+	if !self.Allowed(msg) {
 		return
 	}
 
 	eventMode = Event(strings.ToUpper(string(eventMode)))
 
-	go self.handleString(eventMode, trigger, line)
-	go self.handleRegexp(eventMode, trigger, line)
+	if msg.Batch != nil && eventMode != E_BATCH && eventMode != E_RAW {
+		skip, history := self.SkipBatched()
+		if skip || (msg.IsHistory() && !history) {
+			return
+		}
+	}
+
+	self.enqueue(msg, func() {
+		self.handleString(eventMode, trigger, msg)
+		self.handleRegexp(eventMode, trigger, msg)
+
+		// Commands in replayed history were already run when they were sent
+		if eventMode == E_PRIVMSG && !msg.IsHistory() {
+			self.handleCommand(msg)
+		}
+	})
 }
 
-func (self *Module) handleString(eventMode Event, trigger string, line *irc.Line) {
+func (self *Module) handleString(eventMode Event, trigger string, msg *Message) {
 	trigger = strings.ToLower(trigger)
 	evT := eventTrigger{eventMode, trigger}
 
 	self.stMut.RLock()
-	defer self.stMut.RUnlock()
+	fns := self.stTriggers[evT]
+	self.stMut.RUnlock()
 
-	for _, fn := range self.stTriggers[evT] {
-		go fn(line.Copy())
+	key := fmt.Sprintf("%v %v", eventMode, trigger)
+	for _, fn := range fns {
+		self.supervise(key, func(ctx context.Context) { fn(ctx, msg.Copy()) })
 	}
 }
 
-func (self *Module) handleRegexp(eventMode Event, trigger string, line *irc.Line) {
+func (self *Module) handleRegexp(eventMode Event, trigger string, msg *Message) {
 	self.reMut.RLock()
-	defer self.reMut.RUnlock()
+	reS := self.reTriggers[eventMode]
+	self.reMut.RUnlock()
 
-	for _, reM := range self.reTriggers[eventMode] {
+	for _, reM := range reS {
 		if reM.trigger.MatchString(trigger) {
-			go reM.fn(line.Copy())
+			fn := reM.fn
+			self.supervise(fmt.Sprintf("%v %v", eventMode, reM.trigger), func(ctx context.Context) {
+				fn(ctx, msg.Copy())
+			})
 		}
 	}
 }
 
+// Returns true between a successful Start() and Exit()
+func (self *Module) Running() bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.running
+}
+
+// Returns the Events the module has triggers or commands for
+func (self *Module) Events() []Event {
+	events := make([]Event, 0, len(self.reTriggers)+1)
+	add := func(e Event) {
+		for _, ev := range events {
+			if ev == e {
+				return
+			}
+		}
+
+		events = append(events, e)
+	}
+
+	self.stMut.RLock()
+	for evT := range self.stTriggers {
+		add(evT.event)
+	}
+	self.stMut.RUnlock()
+
+	self.reMut.RLock()
+	for event := range self.reTriggers {
+		add(event)
+	}
+	self.reMut.RUnlock()
+
+	self.cmdMut.RLock()
+	if len(self.commands) != 0 {
+		add(E_PRIVMSG)
+	}
+	self.cmdMut.RUnlock()
+
+	return events
+}
+
 // Returns a list of IRC commands registered
 func (self *Module) StringCommands() []string {
 	output := make([]string, 0, len(self.stTriggers)+len(self.reTriggers))
 
 	self.stMut.RLock()
 	for evTrig := range self.stTriggers {
-		output = append(output, fmt.Sprintf("[%-12v] %v", evTrig.event, evTrig.trigger))
+		output = append(output, fmt.Sprintf("[%-12v] %v", evTrig.event.Name(), evTrig.trigger))
 	}
 	self.stMut.RUnlock()
 
 	self.reMut.RLock()
 	for event, reS := range self.reTriggers {
 		for _, re := range reS {
-			output = append(output, fmt.Sprintf("[%-12v] %v", event, re.trigger))
+			output = append(output, fmt.Sprintf("[%-12v] %v", event.Name(), re.trigger))
 		}
 	}
 	self.reMut.RUnlock()
 
+	for _, cmd := range self.Commands() {
+		output = append(output, fmt.Sprintf("[%-12v] %v", "COMMAND", cmd.Usage()))
+	}
+
 	return output
 }
 
+// Opens the log file and creates a Logger. Locked by callee
 func (self *Module) createLogger() error {
-	if self.LogDir() == "" {
-		self.SetLogDir(logDir)
-	} else if lDir := self.LogDir(); lDir[len(logDir)-1] != '/' {
-		self.SetLogDir(lDir + "/")
-	}
-
-	if err := os.MkdirAll(self.LogDir(), 0755); err != nil || os.IsNotExist(err) {
-		return err
+	if self.m.LogDir == "" {
+		self.m.LogDir = logDir
+	} else if lDir := self.m.LogDir; lDir[len(lDir)-1] != '/' {
+		self.m.LogDir = lDir + "/"
 	}
 
-	logName := fmt.Sprintf("%v%v.log", self.LogDir(), self.Name())
-	file, err := os.OpenFile(logName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	file, err := self.openLog()
 	if err != nil {
 		return err
 	}
@@ -362,6 +540,17 @@ func (self *Module) createLogger() error {
 	return nil
 }
 
+// Opens the log file in LogDir for appending, creating LogDir. Locked by callee
+func (self *Module) openLog() (*os.File, error) {
+	if err := os.MkdirAll(self.m.LogDir, 0755); err != nil {
+		return nil, err
+	}
+
+	logName := fmt.Sprintf("%v%v.log", self.m.LogDir, self.m.Name)
+
+	return os.OpenFile(logName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
+
 func SetLogDir(logdir string) {
 	if logdir[len(logdir)-1] == '/' {
 		logDir = logdir
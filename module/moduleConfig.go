@@ -1,7 +1,9 @@
 package module
 
 import (
+	"strings"
 	"sync"
+	"time"
 )
 
 // ModuleInfo repersents configuration fields that can be loaded from TOML files
@@ -10,6 +12,41 @@ type ModuleInfo struct {
 	Description string // Description of module
 	LogDir      string // Directory to keep logs, defaults to ./logs/
 	Enabled     bool   // Flag to see if module is enabled
+	StateFile   string // File runtime allow/deny changes are saved to
+
+	// Modules started before and stopped after this one. A module is
+	// skipped if one it Requires is missing or fails; After only orders
+	Requires []string
+	After    []string
+
+	// Panics recovered from a trigger or command before it is disabled, 0
+	// never disables. OnPanic "module" disables the whole module instead
+	MaxPanics int
+	OnPanic   string
+
+	// Handlers run on Workers goroutines fed by a queue of QueueSize lines.
+	// Overflow is DropNewest, DropOldest or Block when the queue is full.
+	// Ordered gives each worker its own queue so lines with the same network
+	// and target are handled one at a time in the order they arrived
+	Workers   int
+	QueueSize int
+	Overflow  string
+	Ordered   bool
+
+	// Handler Contexts are cancelled after Timeout seconds, or the seconds in
+	// Timeouts for a trigger such as "PRIVMSG hi" or "COMMAND name"; 0 never
+	// times out. Exit() waits up to ExitTimeout seconds for handlers to return
+	Timeout     int
+	Timeouts    map[string]int
+	ExitTimeout int
+
+	// Lines the server groups in a BATCH, such as a netjoin, are handled one
+	// by one with Message.Batch set. SkipBatched only delivers them together
+	// in the E_BATCH event. Replayed history, such as chathistory playback,
+	// only arrives with E_BATCH unless ReplayHistory is set; commands and
+	// OnAccess handlers never run for it
+	SkipBatched   bool
+	ReplayHistory bool
 
 	// Filtered by: denyUser, allowUser, denyChan, allowChan
 	// ToLower is called on slices when creating a Module
@@ -19,8 +56,11 @@ type ModuleInfo struct {
 
 // A copy of ModuleInfo but fields are not exported
 type moduleConfig struct {
-	m  ModuleInfo
-	mu sync.RWMutex
+	m      ModuleInfo
+	config moduleState // Allow/deny lists as last read from the config file
+	mu     sync.RWMutex
+
+	stateMu sync.Mutex // Held while writing StateFile
 }
 
 // Returns the module name
@@ -88,3 +128,96 @@ func (self *moduleConfig) SetLogDir(logDir string) {
 
 	self.m.LogDir = logDir
 }
+
+// Returns a copy of the names of modules that must start first
+func (self *moduleConfig) Requires() []string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	requires := make([]string, len(self.m.Requires))
+	copy(requires, self.m.Requires)
+
+	return requires
+}
+
+// Returns a copy of the names of modules to start first if they are registered
+func (self *moduleConfig) After() []string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	after := make([]string, len(self.m.After))
+	copy(after, self.m.After)
+
+	return after
+}
+
+// Returns the timeout of handlers of trigger `key`, 0 if they have none
+func (self *moduleConfig) Timeout(key string) time.Duration {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	seconds, ok := self.m.Timeouts[strings.ToLower(key)]
+	if !ok {
+		seconds = self.m.Timeout
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// Returns the panic threshold and what is disabled when it is reached,
+// "trigger" or "module"
+func (self *moduleConfig) MaxPanics() (int, string) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.m.MaxPanics, self.m.OnPanic
+}
+
+// Returns `true` if lines in a BATCH are only delivered with E_BATCH, and
+// `true` if replayed history is delivered line by line as well
+func (self *moduleConfig) SkipBatched() (bool, bool) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.m.SkipBatched, self.m.ReplayHistory
+}
+
+// Defaults LogDir and lowers dependency and allow/deny slices
+func (self *ModuleInfo) normalize() {
+	if self.LogDir == "" {
+		self.LogDir = logDir
+	} else if self.LogDir[len(self.LogDir)-1:] != "/" {
+		self.LogDir = self.LogDir + "/"
+	}
+
+	if self.Workers <= 0 {
+		self.Workers = defaultWorkers
+	}
+	if self.ExitTimeout <= 0 {
+		self.ExitTimeout = defaultExitTimeout
+	}
+	timeouts := make(map[string]int, len(self.Timeouts))
+	for trigger, seconds := range self.Timeouts {
+		timeouts[strings.ToLower(trigger)] = seconds
+	}
+	self.Timeouts = timeouts
+	if self.QueueSize <= 0 {
+		self.QueueSize = defaultQueueSize
+	}
+	switch self.Overflow = strings.ToLower(self.Overflow); self.Overflow {
+	case DropNewest, DropOldest, Block:
+	default:
+		self.Overflow = DropNewest
+	}
+
+	if self.OnPanic = strings.ToLower(self.OnPanic); self.OnPanic != "module" {
+		self.OnPanic = "trigger"
+	}
+
+	toLowerSlice(self.Requires)
+	toLowerSlice(self.After)
+	toLowerSlice(self.AllowUser)
+	toLowerSlice(self.DenyUser)
+	toLowerSlice(self.AllowChan)
+	toLowerSlice(self.DenyChan)
+}
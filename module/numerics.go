@@ -0,0 +1,400 @@
+// Code generated by gen_numerics.go from numerics.txt; DO NOT EDIT.
+
+package module
+
+// Numeric replies to trigger on
+const (
+	RPL_WELCOME           Event = "001"
+	RPL_YOURHOST          Event = "002"
+	RPL_CREATED           Event = "003"
+	RPL_MYINFO            Event = "004"
+	RPL_ISUPPORT          Event = "005"
+	RPL_BOUNCE            Event = "005"
+	RPL_REDIR             Event = "010"
+	RPL_TRACELINK         Event = "200"
+	RPL_TRACECONNECTING   Event = "201"
+	RPL_TRACEHANDSHAKE    Event = "202"
+	RPL_TRACEUNKNOWN      Event = "203"
+	RPL_TRACEOPERATOR     Event = "204"
+	RPL_TRACEUSER         Event = "205"
+	RPL_TRACESERVER       Event = "206"
+	RPL_TRACESERVICE      Event = "207"
+	RPL_TRACENEWTYPE      Event = "208"
+	RPL_TRACECLASS        Event = "209"
+	RPL_TRACERECONNECT    Event = "210"
+	RPL_STATSLINKINFO     Event = "211"
+	RPL_STATSCOMMANDS     Event = "212"
+	RPL_STATSCLINE        Event = "213"
+	RPL_STATSNLINE        Event = "214"
+	RPL_STATSILINE        Event = "215"
+	RPL_STATSKLINE        Event = "216"
+	RPL_STATSQLINE        Event = "217"
+	RPL_STATSYLINE        Event = "218"
+	RPL_ENDOFSTATS        Event = "219"
+	RPL_UMODEIS           Event = "221"
+	RPL_SERVICEINFO       Event = "231"
+	RPL_ENDOFSERVICES     Event = "232"
+	RPL_SERVICE           Event = "233"
+	RPL_SERVLIST          Event = "234"
+	RPL_SERVLISTEND       Event = "235"
+	RPL_STATSVLINE        Event = "240"
+	RPL_STATSLLINE        Event = "241"
+	RPL_STATSUPTIME       Event = "242"
+	RPL_STATSOLINE        Event = "243"
+	RPL_STATSHLINE        Event = "244"
+	RPL_STATSSLINE        Event = "245"
+	RPL_STATSPING         Event = "246"
+	RPL_STATSBLINE        Event = "247"
+	RPL_STATSCONN         Event = "250"
+	RPL_LUSERCLIENT       Event = "251"
+	RPL_LUSEROP           Event = "252"
+	RPL_LUSERUNKNOWN      Event = "253"
+	RPL_LUSERCHANNELS     Event = "254"
+	RPL_LUSERME           Event = "255"
+	RPL_ADMINME           Event = "256"
+	RPL_ADMINLOC1         Event = "257"
+	RPL_ADMINLOC2         Event = "258"
+	RPL_ADMINEMAIL        Event = "259"
+	RPL_TRACELOG          Event = "261"
+	RPL_TRACEEND          Event = "262"
+	RPL_TRYAGAIN          Event = "263"
+	RPL_LOCALUSERS        Event = "265"
+	RPL_GLOBALUSERS       Event = "266"
+	RPL_WHOISCERTFP       Event = "276"
+	RPL_NONE              Event = "300"
+	RPL_AWAY              Event = "301"
+	RPL_USERHOST          Event = "302"
+	RPL_ISON              Event = "303"
+	RPL_UNAWAY            Event = "305"
+	RPL_NOWAWAY           Event = "306"
+	RPL_WHOISUSER         Event = "311"
+	RPL_WHOISSERVER       Event = "312"
+	RPL_WHOISOPERATOR     Event = "313"
+	RPL_WHOWASUSER        Event = "314"
+	RPL_ENDOFWHO          Event = "315"
+	RPL_WHOISIDLE         Event = "317"
+	RPL_ENDOFWHOIS        Event = "318"
+	RPL_WHOISCHANNELS     Event = "319"
+	RPL_LISTSTART         Event = "321"
+	RPL_LIST              Event = "322"
+	RPL_LISTEND           Event = "323"
+	RPL_CHANNELMODEIS     Event = "324"
+	RPL_UNIQOPIS          Event = "325"
+	RPL_CREATIONTIME      Event = "329"
+	RPL_WHOISACCOUNT      Event = "330"
+	RPL_NOTOPIC           Event = "331"
+	RPL_TOPIC             Event = "332"
+	RPL_TOPICWHOTIME      Event = "333"
+	RPL_WHOISACTUALLY     Event = "338"
+	RPL_INVITING          Event = "341"
+	RPL_SUMMONING         Event = "342"
+	RPL_INVITELIST        Event = "346"
+	RPL_ENDOFINVITELIST   Event = "347"
+	RPL_EXCEPTLIST        Event = "348"
+	RPL_ENDOFEXCEPTLIST   Event = "349"
+	RPL_VERSION           Event = "351"
+	RPL_WHOREPLY          Event = "352"
+	RPL_NAMREPLY          Event = "353"
+	RPL_WHOSPCRPL         Event = "354"
+	RPL_LINKS             Event = "364"
+	RPL_ENDOFLINKS        Event = "365"
+	RPL_ENDOFNAMES        Event = "366"
+	RPL_BANLIST           Event = "367"
+	RPL_ENDOFBANLIST      Event = "368"
+	RPL_ENDOFWHOWAS       Event = "369"
+	RPL_INFO              Event = "371"
+	RPL_MOTD              Event = "372"
+	RPL_ENDOFINFO         Event = "374"
+	RPL_MOTDSTART         Event = "375"
+	RPL_ENDOFMOTD         Event = "376"
+	RPL_WHOISHOST         Event = "378"
+	RPL_WHOISMODES        Event = "379"
+	RPL_YOUREOPER         Event = "381"
+	RPL_REHASHING         Event = "382"
+	RPL_YOURESERVICE      Event = "383"
+	RPL_TIME              Event = "391"
+	RPL_USERSSTART        Event = "392"
+	RPL_USERS             Event = "393"
+	RPL_ENDOFUSERS        Event = "394"
+	RPL_NOUSERS           Event = "395"
+	RPL_VISIBLEHOST       Event = "396"
+	ERR_UNKNOWNERROR      Event = "400"
+	ERR_NOSUCHNICK        Event = "401"
+	ERR_NOSUCHSERVER      Event = "402"
+	ERR_NOSUCHCHANNEL     Event = "403"
+	ERR_CANNOTSENDTOCHAN  Event = "404"
+	ERR_TOOMANYCHANNELS   Event = "405"
+	ERR_WASNOSUCHNICK     Event = "406"
+	ERR_TOOMANYTARGETS    Event = "407"
+	ERR_NOSUCHSERVICE     Event = "408"
+	ERR_NOORIGIN          Event = "409"
+	ERR_NORECIPIENT       Event = "411"
+	ERR_NOTEXTTOSEND      Event = "412"
+	ERR_NOTOPLEVEL        Event = "413"
+	ERR_WILDTOPLEVEL      Event = "414"
+	ERR_BADMASK           Event = "415"
+	ERR_INPUTTOOLONG      Event = "417"
+	ERR_UNKNOWNCOMMAND    Event = "421"
+	ERR_NOMOTD            Event = "422"
+	ERR_NOADMININFO       Event = "423"
+	ERR_FILEERROR         Event = "424"
+	ERR_NONICKNAMEGIVEN   Event = "431"
+	ERR_ERRONEUSNICKNAME  Event = "432"
+	ERR_NICKNAMEINUSE     Event = "433"
+	ERR_NICKCOLLISION     Event = "436"
+	ERR_UNAVAILRESOURCE   Event = "437"
+	ERR_USERNOTINCHANNEL  Event = "441"
+	ERR_NOTONCHANNEL      Event = "442"
+	ERR_USERONCHANNEL     Event = "443"
+	ERR_NOLOGIN           Event = "444"
+	ERR_SUMMONDISABLED    Event = "445"
+	ERR_USERSDISABLED     Event = "446"
+	ERR_NOTREGISTERED     Event = "451"
+	ERR_NEEDMOREPARAMS    Event = "461"
+	ERR_ALREADYREGISTRED  Event = "462"
+	ERR_NOPERMFORHOST     Event = "463"
+	ERR_PASSWDMISMATCH    Event = "464"
+	ERR_YOUREBANNEDCREEP  Event = "465"
+	ERR_YOUWILLBEBANNED   Event = "466"
+	ERR_KEYSET            Event = "467"
+	ERR_CHANNELISFULL     Event = "471"
+	ERR_UNKNOWNMODE       Event = "472"
+	ERR_INVITEONLYCHAN    Event = "473"
+	ERR_BANNEDFROMCHAN    Event = "474"
+	ERR_BADCHANNELKEY     Event = "475"
+	ERR_BADCHANMASK       Event = "476"
+	ERR_NOCHANMODES       Event = "477"
+	ERR_BANLISTFULL       Event = "478"
+	ERR_NOPRIVILEGES      Event = "481"
+	ERR_CHANOPRIVSNEEDED  Event = "482"
+	ERR_CANTKILLSERVER    Event = "483"
+	ERR_RESTRICTED        Event = "484"
+	ERR_UNIQOPPRIVSNEEDED Event = "485"
+	ERR_NOOPERHOST        Event = "491"
+	ERR_UMODEUNKNOWNFLAG  Event = "501"
+	ERR_USERSDONTMATCH    Event = "502"
+	ERR_HELPNOTFOUND      Event = "524"
+	ERR_INVALIDKEY        Event = "525"
+	RPL_STARTTLS          Event = "670"
+	RPL_WHOISSECURE       Event = "671"
+	ERR_STARTTLS          Event = "691"
+	ERR_INVALIDMODEPARAM  Event = "696"
+	RPL_HELPSTART         Event = "704"
+	RPL_HELPTXT           Event = "705"
+	RPL_ENDOFHELP         Event = "706"
+	ERR_NOPRIVS           Event = "723"
+	RPL_QUIETLIST         Event = "728"
+	RPL_ENDOFQUIETLIST    Event = "729"
+	RPL_MONONLINE         Event = "730"
+	RPL_MONOFFLINE        Event = "731"
+	RPL_MONLIST           Event = "732"
+	RPL_ENDOFMONLIST      Event = "733"
+	ERR_MONLISTFULL       Event = "734"
+	RPL_LOGGEDIN          Event = "900"
+	RPL_LOGGEDOUT         Event = "901"
+	ERR_NICKLOCKED        Event = "902"
+	RPL_SASLSUCCESS       Event = "903"
+	ERR_SASLFAIL          Event = "904"
+	ERR_SASLTOOLONG       Event = "905"
+	ERR_SASLABORTED       Event = "906"
+	ERR_SASLALREADY       Event = "907"
+	RPL_SASLMECHS         Event = "908"
+)
+
+// Name of each numeric; the first listed when a code has several
+var numericNames = map[Event]string{
+	RPL_WELCOME:           "RPL_WELCOME",
+	RPL_YOURHOST:          "RPL_YOURHOST",
+	RPL_CREATED:           "RPL_CREATED",
+	RPL_MYINFO:            "RPL_MYINFO",
+	RPL_ISUPPORT:          "RPL_ISUPPORT",
+	RPL_REDIR:             "RPL_REDIR",
+	RPL_TRACELINK:         "RPL_TRACELINK",
+	RPL_TRACECONNECTING:   "RPL_TRACECONNECTING",
+	RPL_TRACEHANDSHAKE:    "RPL_TRACEHANDSHAKE",
+	RPL_TRACEUNKNOWN:      "RPL_TRACEUNKNOWN",
+	RPL_TRACEOPERATOR:     "RPL_TRACEOPERATOR",
+	RPL_TRACEUSER:         "RPL_TRACEUSER",
+	RPL_TRACESERVER:       "RPL_TRACESERVER",
+	RPL_TRACESERVICE:      "RPL_TRACESERVICE",
+	RPL_TRACENEWTYPE:      "RPL_TRACENEWTYPE",
+	RPL_TRACECLASS:        "RPL_TRACECLASS",
+	RPL_TRACERECONNECT:    "RPL_TRACERECONNECT",
+	RPL_STATSLINKINFO:     "RPL_STATSLINKINFO",
+	RPL_STATSCOMMANDS:     "RPL_STATSCOMMANDS",
+	RPL_STATSCLINE:        "RPL_STATSCLINE",
+	RPL_STATSNLINE:        "RPL_STATSNLINE",
+	RPL_STATSILINE:        "RPL_STATSILINE",
+	RPL_STATSKLINE:        "RPL_STATSKLINE",
+	RPL_STATSQLINE:        "RPL_STATSQLINE",
+	RPL_STATSYLINE:        "RPL_STATSYLINE",
+	RPL_ENDOFSTATS:        "RPL_ENDOFSTATS",
+	RPL_UMODEIS:           "RPL_UMODEIS",
+	RPL_SERVICEINFO:       "RPL_SERVICEINFO",
+	RPL_ENDOFSERVICES:     "RPL_ENDOFSERVICES",
+	RPL_SERVICE:           "RPL_SERVICE",
+	RPL_SERVLIST:          "RPL_SERVLIST",
+	RPL_SERVLISTEND:       "RPL_SERVLISTEND",
+	RPL_STATSVLINE:        "RPL_STATSVLINE",
+	RPL_STATSLLINE:        "RPL_STATSLLINE",
+	RPL_STATSUPTIME:       "RPL_STATSUPTIME",
+	RPL_STATSOLINE:        "RPL_STATSOLINE",
+	RPL_STATSHLINE:        "RPL_STATSHLINE",
+	RPL_STATSSLINE:        "RPL_STATSSLINE",
+	RPL_STATSPING:         "RPL_STATSPING",
+	RPL_STATSBLINE:        "RPL_STATSBLINE",
+	RPL_STATSCONN:         "RPL_STATSCONN",
+	RPL_LUSERCLIENT:       "RPL_LUSERCLIENT",
+	RPL_LUSEROP:           "RPL_LUSEROP",
+	RPL_LUSERUNKNOWN:      "RPL_LUSERUNKNOWN",
+	RPL_LUSERCHANNELS:     "RPL_LUSERCHANNELS",
+	RPL_LUSERME:           "RPL_LUSERME",
+	RPL_ADMINME:           "RPL_ADMINME",
+	RPL_ADMINLOC1:         "RPL_ADMINLOC1",
+	RPL_ADMINLOC2:         "RPL_ADMINLOC2",
+	RPL_ADMINEMAIL:        "RPL_ADMINEMAIL",
+	RPL_TRACELOG:          "RPL_TRACELOG",
+	RPL_TRACEEND:          "RPL_TRACEEND",
+	RPL_TRYAGAIN:          "RPL_TRYAGAIN",
+	RPL_LOCALUSERS:        "RPL_LOCALUSERS",
+	RPL_GLOBALUSERS:       "RPL_GLOBALUSERS",
+	RPL_WHOISCERTFP:       "RPL_WHOISCERTFP",
+	RPL_NONE:              "RPL_NONE",
+	RPL_AWAY:              "RPL_AWAY",
+	RPL_USERHOST:          "RPL_USERHOST",
+	RPL_ISON:              "RPL_ISON",
+	RPL_UNAWAY:            "RPL_UNAWAY",
+	RPL_NOWAWAY:           "RPL_NOWAWAY",
+	RPL_WHOISUSER:         "RPL_WHOISUSER",
+	RPL_WHOISSERVER:       "RPL_WHOISSERVER",
+	RPL_WHOISOPERATOR:     "RPL_WHOISOPERATOR",
+	RPL_WHOWASUSER:        "RPL_WHOWASUSER",
+	RPL_ENDOFWHO:          "RPL_ENDOFWHO",
+	RPL_WHOISIDLE:         "RPL_WHOISIDLE",
+	RPL_ENDOFWHOIS:        "RPL_ENDOFWHOIS",
+	RPL_WHOISCHANNELS:     "RPL_WHOISCHANNELS",
+	RPL_LISTSTART:         "RPL_LISTSTART",
+	RPL_LIST:              "RPL_LIST",
+	RPL_LISTEND:           "RPL_LISTEND",
+	RPL_CHANNELMODEIS:     "RPL_CHANNELMODEIS",
+	RPL_UNIQOPIS:          "RPL_UNIQOPIS",
+	RPL_CREATIONTIME:      "RPL_CREATIONTIME",
+	RPL_WHOISACCOUNT:      "RPL_WHOISACCOUNT",
+	RPL_NOTOPIC:           "RPL_NOTOPIC",
+	RPL_TOPIC:             "RPL_TOPIC",
+	RPL_TOPICWHOTIME:      "RPL_TOPICWHOTIME",
+	RPL_WHOISACTUALLY:     "RPL_WHOISACTUALLY",
+	RPL_INVITING:          "RPL_INVITING",
+	RPL_SUMMONING:         "RPL_SUMMONING",
+	RPL_INVITELIST:        "RPL_INVITELIST",
+	RPL_ENDOFINVITELIST:   "RPL_ENDOFINVITELIST",
+	RPL_EXCEPTLIST:        "RPL_EXCEPTLIST",
+	RPL_ENDOFEXCEPTLIST:   "RPL_ENDOFEXCEPTLIST",
+	RPL_VERSION:           "RPL_VERSION",
+	RPL_WHOREPLY:          "RPL_WHOREPLY",
+	RPL_NAMREPLY:          "RPL_NAMREPLY",
+	RPL_WHOSPCRPL:         "RPL_WHOSPCRPL",
+	RPL_LINKS:             "RPL_LINKS",
+	RPL_ENDOFLINKS:        "RPL_ENDOFLINKS",
+	RPL_ENDOFNAMES:        "RPL_ENDOFNAMES",
+	RPL_BANLIST:           "RPL_BANLIST",
+	RPL_ENDOFBANLIST:      "RPL_ENDOFBANLIST",
+	RPL_ENDOFWHOWAS:       "RPL_ENDOFWHOWAS",
+	RPL_INFO:              "RPL_INFO",
+	RPL_MOTD:              "RPL_MOTD",
+	RPL_ENDOFINFO:         "RPL_ENDOFINFO",
+	RPL_MOTDSTART:         "RPL_MOTDSTART",
+	RPL_ENDOFMOTD:         "RPL_ENDOFMOTD",
+	RPL_WHOISHOST:         "RPL_WHOISHOST",
+	RPL_WHOISMODES:        "RPL_WHOISMODES",
+	RPL_YOUREOPER:         "RPL_YOUREOPER",
+	RPL_REHASHING:         "RPL_REHASHING",
+	RPL_YOURESERVICE:      "RPL_YOURESERVICE",
+	RPL_TIME:              "RPL_TIME",
+	RPL_USERSSTART:        "RPL_USERSSTART",
+	RPL_USERS:             "RPL_USERS",
+	RPL_ENDOFUSERS:        "RPL_ENDOFUSERS",
+	RPL_NOUSERS:           "RPL_NOUSERS",
+	RPL_VISIBLEHOST:       "RPL_VISIBLEHOST",
+	ERR_UNKNOWNERROR:      "ERR_UNKNOWNERROR",
+	ERR_NOSUCHNICK:        "ERR_NOSUCHNICK",
+	ERR_NOSUCHSERVER:      "ERR_NOSUCHSERVER",
+	ERR_NOSUCHCHANNEL:     "ERR_NOSUCHCHANNEL",
+	ERR_CANNOTSENDTOCHAN:  "ERR_CANNOTSENDTOCHAN",
+	ERR_TOOMANYCHANNELS:   "ERR_TOOMANYCHANNELS",
+	ERR_WASNOSUCHNICK:     "ERR_WASNOSUCHNICK",
+	ERR_TOOMANYTARGETS:    "ERR_TOOMANYTARGETS",
+	ERR_NOSUCHSERVICE:     "ERR_NOSUCHSERVICE",
+	ERR_NOORIGIN:          "ERR_NOORIGIN",
+	ERR_NORECIPIENT:       "ERR_NORECIPIENT",
+	ERR_NOTEXTTOSEND:      "ERR_NOTEXTTOSEND",
+	ERR_NOTOPLEVEL:        "ERR_NOTOPLEVEL",
+	ERR_WILDTOPLEVEL:      "ERR_WILDTOPLEVEL",
+	ERR_BADMASK:           "ERR_BADMASK",
+	ERR_INPUTTOOLONG:      "ERR_INPUTTOOLONG",
+	ERR_UNKNOWNCOMMAND:    "ERR_UNKNOWNCOMMAND",
+	ERR_NOMOTD:            "ERR_NOMOTD",
+	ERR_NOADMININFO:       "ERR_NOADMININFO",
+	ERR_FILEERROR:         "ERR_FILEERROR",
+	ERR_NONICKNAMEGIVEN:   "ERR_NONICKNAMEGIVEN",
+	ERR_ERRONEUSNICKNAME:  "ERR_ERRONEUSNICKNAME",
+	ERR_NICKNAMEINUSE:     "ERR_NICKNAMEINUSE",
+	ERR_NICKCOLLISION:     "ERR_NICKCOLLISION",
+	ERR_UNAVAILRESOURCE:   "ERR_UNAVAILRESOURCE",
+	ERR_USERNOTINCHANNEL:  "ERR_USERNOTINCHANNEL",
+	ERR_NOTONCHANNEL:      "ERR_NOTONCHANNEL",
+	ERR_USERONCHANNEL:     "ERR_USERONCHANNEL",
+	ERR_NOLOGIN:           "ERR_NOLOGIN",
+	ERR_SUMMONDISABLED:    "ERR_SUMMONDISABLED",
+	ERR_USERSDISABLED:     "ERR_USERSDISABLED",
+	ERR_NOTREGISTERED:     "ERR_NOTREGISTERED",
+	ERR_NEEDMOREPARAMS:    "ERR_NEEDMOREPARAMS",
+	ERR_ALREADYREGISTRED:  "ERR_ALREADYREGISTRED",
+	ERR_NOPERMFORHOST:     "ERR_NOPERMFORHOST",
+	ERR_PASSWDMISMATCH:    "ERR_PASSWDMISMATCH",
+	ERR_YOUREBANNEDCREEP:  "ERR_YOUREBANNEDCREEP",
+	ERR_YOUWILLBEBANNED:   "ERR_YOUWILLBEBANNED",
+	ERR_KEYSET:            "ERR_KEYSET",
+	ERR_CHANNELISFULL:     "ERR_CHANNELISFULL",
+	ERR_UNKNOWNMODE:       "ERR_UNKNOWNMODE",
+	ERR_INVITEONLYCHAN:    "ERR_INVITEONLYCHAN",
+	ERR_BANNEDFROMCHAN:    "ERR_BANNEDFROMCHAN",
+	ERR_BADCHANNELKEY:     "ERR_BADCHANNELKEY",
+	ERR_BADCHANMASK:       "ERR_BADCHANMASK",
+	ERR_NOCHANMODES:       "ERR_NOCHANMODES",
+	ERR_BANLISTFULL:       "ERR_BANLISTFULL",
+	ERR_NOPRIVILEGES:      "ERR_NOPRIVILEGES",
+	ERR_CHANOPRIVSNEEDED:  "ERR_CHANOPRIVSNEEDED",
+	ERR_CANTKILLSERVER:    "ERR_CANTKILLSERVER",
+	ERR_RESTRICTED:        "ERR_RESTRICTED",
+	ERR_UNIQOPPRIVSNEEDED: "ERR_UNIQOPPRIVSNEEDED",
+	ERR_NOOPERHOST:        "ERR_NOOPERHOST",
+	ERR_UMODEUNKNOWNFLAG:  "ERR_UMODEUNKNOWNFLAG",
+	ERR_USERSDONTMATCH:    "ERR_USERSDONTMATCH",
+	ERR_HELPNOTFOUND:      "ERR_HELPNOTFOUND",
+	ERR_INVALIDKEY:        "ERR_INVALIDKEY",
+	RPL_STARTTLS:          "RPL_STARTTLS",
+	RPL_WHOISSECURE:       "RPL_WHOISSECURE",
+	ERR_STARTTLS:          "ERR_STARTTLS",
+	ERR_INVALIDMODEPARAM:  "ERR_INVALIDMODEPARAM",
+	RPL_HELPSTART:         "RPL_HELPSTART",
+	RPL_HELPTXT:           "RPL_HELPTXT",
+	RPL_ENDOFHELP:         "RPL_ENDOFHELP",
+	ERR_NOPRIVS:           "ERR_NOPRIVS",
+	RPL_QUIETLIST:         "RPL_QUIETLIST",
+	RPL_ENDOFQUIETLIST:    "RPL_ENDOFQUIETLIST",
+	RPL_MONONLINE:         "RPL_MONONLINE",
+	RPL_MONOFFLINE:        "RPL_MONOFFLINE",
+	RPL_MONLIST:           "RPL_MONLIST",
+	RPL_ENDOFMONLIST:      "RPL_ENDOFMONLIST",
+	ERR_MONLISTFULL:       "ERR_MONLISTFULL",
+	RPL_LOGGEDIN:          "RPL_LOGGEDIN",
+	RPL_LOGGEDOUT:         "RPL_LOGGEDOUT",
+	ERR_NICKLOCKED:        "ERR_NICKLOCKED",
+	RPL_SASLSUCCESS:       "RPL_SASLSUCCESS",
+	ERR_SASLFAIL:          "ERR_SASLFAIL",
+	ERR_SASLTOOLONG:       "ERR_SASLTOOLONG",
+	ERR_SASLABORTED:       "ERR_SASLABORTED",
+	ERR_SASLALREADY:       "ERR_SASLALREADY",
+	RPL_SASLMECHS:         "RPL_SASLMECHS",
+}
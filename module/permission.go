@@ -0,0 +1,61 @@
+package module
+
+import (
+	"fmt"
+)
+
+// Access looks up users in the library's access groups. It is assigned to
+// Module.Access when the module is registered
+type Access interface {
+	// Returns the first group `src` is in or an empty string
+	InGroups(src Source, groups ...string) string
+}
+
+// Register a function like On() that is only called if the user is in access
+// group `group`. Other users are logged but not told; the trigger may match
+// lines that were not meant for the module
+func (self *Module) OnAccess(group string, eventMode Event, trigger interface{}, fn func(*Message)) {
+	what := fmt.Sprintf("%v %v", eventMode, trigger)
+
+	self.On(eventMode, trigger, func(msg *Message) {
+		// Replayed history is never acted on
+		if msg.IsHistory() {
+			return
+		}
+
+		if !self.InGroup(msg, group) {
+			self.Logger.Infof("Denied %v on %v: %v requires %v\n",
+				msg.Src, msg.Network, what, group)
+
+			return
+		}
+
+		fn(msg)
+	})
+}
+
+// Returns true if the user who sent `msg` is in access group `group`
+func (self *Module) InGroup(msg *Message, group string) bool {
+	if self.Access == nil || msg.Nick == "" {
+		return false
+	}
+
+	return self.Access.InGroups(msg.Source(), group) != ""
+}
+
+// Returns true if the user is in `group`; otherwise replies with a denial and
+// logs the attempt. Used for commands, which are explicitly invoked
+func (self *Module) checkAccess(msg *Message, group, what string) bool {
+	if self.InGroup(msg, group) {
+		return true
+	}
+
+	self.Logger.Warnf("Denied %v on %v: %v requires %v\n",
+		msg.Src, msg.Network, what, group)
+
+	if msg.Client != nil && msg.Nick != "" {
+		msg.Client.Notice(msg.Nick, fmt.Sprintf("Permission denied: %v requires %v", what, group))
+	}
+
+	return false
+}
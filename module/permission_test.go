@@ -0,0 +1,64 @@
+package module
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	irc "github.com/fluffle/goirc/client"
+)
+
+// Access with no one in any group
+type noAccess struct{}
+
+func (noAccess) InGroups(src Source, groups ...string) string { return "" }
+
+func TestOnAccessDenied(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irclib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	info := &ModuleInfo{Name: "test", Description: "Test module", Enabled: true, LogDir: dir}
+	mod, err := info.NewModule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod.Access = noAccess{}
+
+	called := false
+	mod.OnAccess("admin", E_PRIVMSG, "!secret", func(msg *Message) {
+		called = true
+	})
+
+	if err := mod.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	line := &irc.Line{
+		Nick: "mallory", Ident: "m", Host: "host", Src: "mallory!m@host",
+		Cmd: "PRIVMSG", Args: []string{"#bots", "!secret"},
+	}
+	mod.Handle(E_PRIVMSG, "!secret", &Message{Line: line, Network: "test"})
+	defer mod.Exit()
+
+	// The handler runs on a worker and the logger writes in the background
+	logged := false
+	for deadline := time.Now().Add(2 * time.Second); !logged && time.Now().Before(deadline); {
+		for _, l := range mod.Logger.Logs(0) {
+			logged = logged || (strings.Contains(l, "Denied mallory!m@host") && strings.Contains(l, "requires admin"))
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !logged {
+		t.Errorf("Denial was not logged: %q", mod.Logger.Logs(0))
+	}
+	if called {
+		t.Error("OnAccess handler ran for a user outside the group")
+	}
+}
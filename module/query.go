@@ -0,0 +1,111 @@
+package module
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Queries send a request and collect the numeric replies up to its END
+// numeric. Without a deadline on ctx a query times out after QueryTimeout
+type Queries interface {
+	Whois(ctx context.Context, nick string) (*WhoisReply, error)
+	Who(ctx context.Context, mask string) ([]WhoReply, error)
+	Names(ctx context.Context, channel string) ([]Member, error)
+	ListChannels(ctx context.Context) ([]ListReply, error)
+	Mode(ctx context.Context, channel string) (*ModeReply, error)
+
+	// Returns up to `limit` messages sent to `target` before `before`, or the
+	// latest if it is zero, oldest first. Needs the chathistory and batch caps
+	ChatHistory(ctx context.Context, target string, before time.Time, limit int) ([]*Message, error)
+}
+
+// Time a query waits for its replies when ctx has no deadline
+var QueryTimeout = 30 * time.Second
+
+// ReplyError is an error numeric such as ERR_NOSUCHNICK answering a query
+type ReplyError struct {
+	Code Event
+	Text string // Human readable text sent by the server
+}
+
+func (self *ReplyError) Error() string {
+	return self.Code.Name() + ": " + self.Text
+}
+
+// Result of Whois
+type WhoisReply struct {
+	Nick, Ident, Host, Name string
+	Server, ServerInfo      string
+	Account                 string // Empty if not logged in
+	Away                    bool
+	AwayMsg                 string
+	Oper                    bool
+	Secure                  bool // Connected with TLS
+	Idle                    time.Duration
+	SignOn                  time.Time
+	Channels                []string // Channels with prefixes as sent, such as "@#bots"
+}
+
+// Line of the result of Who
+type WhoReply struct {
+	Channel, Ident, Host, Server, Nick string
+	Away                               bool
+	Oper                               bool
+	Privs                              Privs // Privileges in Channel
+	Hops                               int
+	Name                               string
+}
+
+// Line of the result of ListChannels
+type ListReply struct {
+	Channel string
+	Users   int
+	Topic   string
+}
+
+// Result of Mode
+type ModeReply struct {
+	Channel string
+	Modes   string    // Mode string such as "+ntk"
+	Params  []string  // Parameters of the modes in order
+	Created time.Time // Zero if the server did not send it
+}
+
+// Returns the privileges given by the prefixes of `nick`, such as "@+alice",
+// and the nick without them, using DefaultModeTypes. Use
+// Client.ModeTypes().ParsePrefixes() for the prefixes a network advertised
+func ParsePrefixes(nick string) (Privs, string) {
+	return DefaultModeTypes.ParsePrefixes(nick)
+}
+
+// Returns the privileges given by the prefixes of `nick`, such as "@+alice",
+// and the nick without them. Prefixes of modes other than qaohv are removed
+// without setting a privilege
+func (self ModeTypes) ParsePrefixes(nick string) (Privs, string) {
+	var privs Privs
+
+	for nick != "" {
+		i := strings.IndexByte(self.PrefixSymbols, nick[0])
+		if i == -1 || i >= len(self.Prefix) {
+			return privs, nick
+		}
+
+		switch self.Prefix[i] {
+		case 'q':
+			privs.Owner = true
+		case 'a':
+			privs.Admin = true
+		case 'o':
+			privs.Op = true
+		case 'h':
+			privs.HalfOp = true
+		case 'v':
+			privs.Voice = true
+		}
+
+		nick = nick[1:]
+	}
+
+	return privs, nick
+}
@@ -0,0 +1,147 @@
+package module
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// Returns the file the module was read from or an empty string if it was
+// created from a ModuleInfo
+func (self *Module) ConfigFile() string {
+	return self.configFile
+}
+
+// Re-reads the config file and applies the description, Enabled, allow/deny
+// lists and log directory. Only lists edited in the config file since it was
+// last read replace runtime changes; StateFile is not written. A module
+// created from a ModuleInfo only reloads its state file. The name of a module
+// can not change. Returns a description of each change
+func (self *Module) Reload() ([]string, error) {
+	if self.configFile == "" {
+		return nil, self.LoadState()
+	}
+
+	modInfo, err := readModuleInfo(self.configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(modInfo.Name, self.Name()) {
+		return nil, fmt.Errorf("Module.Reload(): name changed from %v to %v",
+			self.Name(), modInfo.Name)
+	}
+
+	modInfo.normalize()
+	changes := make([]string, 0, 5)
+
+	self.mu.Lock()
+	old := self.m
+
+	if old.Description != modInfo.Description {
+		changes = append(changes, "description")
+	}
+	if old.Enabled != modInfo.Enabled {
+		changes = append(changes, fmt.Sprintf("enabled %v", modInfo.Enabled))
+	}
+	if !equalSlices(old.Requires, modInfo.Requires) || !equalSlices(old.After, modInfo.After) {
+		changes = append(changes, "dependencies need a restart")
+	}
+
+	if old.Workers != modInfo.Workers || old.QueueSize != modInfo.QueueSize ||
+		old.Overflow != modInfo.Overflow || old.Ordered != modInfo.Ordered {
+
+		changes = append(changes, "workers need a restart")
+	}
+	if old.MaxPanics != modInfo.MaxPanics || old.OnPanic != modInfo.OnPanic {
+		changes = append(changes, fmt.Sprintf("max panics %v per %v", modInfo.MaxPanics, modInfo.OnPanic))
+	}
+
+	self.m.Description = modInfo.Description
+	self.m.MaxPanics, self.m.OnPanic = modInfo.MaxPanics, modInfo.OnPanic
+	self.m.Timeout, self.m.Timeouts = modInfo.Timeout, modInfo.Timeouts
+	self.m.ExitTimeout = modInfo.ExitTimeout
+	self.m.SkipBatched, self.m.ReplayHistory = modInfo.SkipBatched, modInfo.ReplayHistory
+	self.m.Enabled = modInfo.Enabled
+	self.m.StateFile = modInfo.StateFile
+
+	// Lists left as they were in the config keep their runtime changes
+	prev, config := self.config, listsOf(modInfo)
+	if !equalSlices(prev.AllowUser, config.AllowUser) {
+		self.m.AllowUser = copySlice(config.AllowUser)
+	}
+	if !equalSlices(prev.DenyUser, config.DenyUser) {
+		self.m.DenyUser = copySlice(config.DenyUser)
+	}
+	if !equalSlices(prev.AllowChan, config.AllowChan) {
+		self.m.AllowChan = copySlice(config.AllowChan)
+	}
+	if !equalSlices(prev.DenyChan, config.DenyChan) {
+		self.m.DenyChan = copySlice(config.DenyChan)
+	}
+	self.config = config
+	self.mu.Unlock()
+
+	if !equalSlices(old.AllowUser, self.GetAllowed(UC_User)) ||
+		!equalSlices(old.DenyUser, self.GetDenyed(UC_User)) ||
+		!equalSlices(old.AllowChan, self.GetAllowed(UC_Chan)) ||
+		!equalSlices(old.DenyChan, self.GetDenyed(UC_Chan)) {
+
+		changes = append(changes, "allow/deny lists")
+	}
+
+	if old.LogDir != modInfo.LogDir {
+		if err := self.moveLogs(modInfo.LogDir); err != nil {
+			return changes, err
+		}
+
+		changes = append(changes, "log directory "+modInfo.LogDir)
+	}
+
+	return changes, nil
+}
+
+// Opens a log file in `dir` and closes the old one. The Logger is kept, so
+// handlers using it, its priority and logs kept in memory are unaffected
+func (self *Module) moveLogs(dir string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.m.LogDir = dir
+	if self.file == nil {
+		return nil
+	}
+
+	file, err := self.openLog()
+	if err != nil {
+		return err
+	}
+
+	// Lines are no longer written to the old file once setOutput() returns
+	oldFile, oldBuf := self.file, self.bufFile
+	self.file, self.bufFile = file, bufio.NewWriter(file)
+	self.Logger.setOutput(self.bufFile)
+
+	if err := oldBuf.Flush(); err != nil {
+		oldFile.Close()
+
+		return err
+	}
+
+	return oldFile.Close()
+}
+
+// Returns true if `a` and `b` hold the same strings in the same order
+func equalSlices(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
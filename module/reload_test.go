@@ -0,0 +1,95 @@
+package module
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes a module config to `dir` and returns its path
+func writeModuleConfig(t *testing.T, dir, lists string) string {
+	t.Helper()
+
+	config := "name = \"test\"\ndescription = \"Test module\"\nenabled = true\n" +
+		"logdir = \"" + filepath.Join(dir, "logs") + "\"\n" + lists
+
+	file := filepath.Join(dir, "test.toml")
+	if err := ioutil.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func TestReloadKeepsRuntimeChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irclib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := writeModuleConfig(t, dir, "allowuser = [\"alice\"]\n")
+	mod, err := New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mod.Allow("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mod.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !inSlice(mod.GetAllowed(UC_User), "bob") {
+		t.Errorf("Reload dropped the runtime grant: %v", mod.GetAllowed(UC_User))
+	}
+
+	if _, err := os.Stat(mod.StateFile()); !os.IsNotExist(err) {
+		t.Errorf("Reload wrote %v", mod.StateFile())
+	}
+
+	// Lists edited in the config replace runtime changes to them
+	writeModuleConfig(t, dir, "allowuser = [\"alice\"]\ndenyuser = [\"mallory\"]\n")
+	if _, err := mod.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !inSlice(mod.GetAllowed(UC_User), "bob") {
+		t.Errorf("Reload dropped the runtime grant: %v", mod.GetAllowed(UC_User))
+	}
+	if !inSlice(mod.GetDenyed(UC_User), "mallory") {
+		t.Errorf("Reload did not apply the edited deny list: %v", mod.GetDenyed(UC_User))
+	}
+}
+
+func TestMoveLogsKeepsLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irclib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	info := &ModuleInfo{Name: "test", Description: "Test module", LogDir: filepath.Join(dir, "a")}
+	mod, err := info.NewModule()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := mod.Logger
+	logger.SetPriority(Pdebug)
+
+	if err := mod.moveLogs(filepath.Join(dir, "b") + "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if mod.Logger != logger || mod.Logger.Priority() != Pdebug {
+		t.Errorf("moveLogs replaced the Logger or its priority")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "b", "test.log")); err != nil {
+		t.Errorf("moveLogs did not open a log in the new directory: %v", err)
+	}
+}
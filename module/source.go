@@ -0,0 +1,74 @@
+package module
+
+import (
+	"strings"
+)
+
+// Source identifies who sent a line for access and allow/deny checks
+type Source struct {
+	Nick, Ident, Host string
+	Account           string // Services account, empty if unknown or not logged in
+}
+
+// Returns the source as nick!ident@host
+func (self Source) String() string {
+	return self.Nick + "!" + self.Ident + "@" + self.Host
+}
+
+// Returns true if `mask` matches the source. A mask is a nick, which anyone can
+// take, a nick!ident@host hostmask or a services account as $a:account. '*'
+// and '?' are wildcards and matching is case insensitive
+func (self Source) Match(mask string) bool {
+	mask = strings.ToLower(mask)
+
+	switch {
+	case strings.HasPrefix(mask, "$a:"):
+		return self.Account != "" && globMatch(mask[3:], strings.ToLower(self.Account))
+	case strings.ContainsAny(mask, "!@"):
+		return globMatch(mask, strings.ToLower(self.String()))
+	default:
+		return self.Nick != "" && globMatch(mask, strings.ToLower(self.Nick))
+	}
+}
+
+// Returns true if any mask in `masks` matches the source
+func (self Source) MatchAny(masks []string) bool {
+	for _, mask := range masks {
+		if self.Match(mask) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Matches `s` against `pattern` where '*' matches any run of characters and
+// '?' any single character. Unlike path.Match '[' has no special meaning, as
+// it is valid in nicks
+func globMatch(pattern, s string) bool {
+	star, backtrack := -1, 0
+	p, i := 0, 0
+
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, backtrack = p, i
+			p++
+		case star != -1:
+			p = star + 1
+			backtrack++
+			i = backtrack
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
@@ -0,0 +1,111 @@
+package module
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Part of ModuleInfo that is changed at runtime and saved to StateFile
+type moduleState struct {
+	AllowUser, DenyUser []string
+	AllowChan, DenyChan []string
+}
+
+// Returns copies of the allow/deny lists of `info`
+func listsOf(info *ModuleInfo) moduleState {
+	return moduleState{
+		AllowUser: copySlice(info.AllowUser),
+		DenyUser:  copySlice(info.DenyUser),
+		AllowChan: copySlice(info.AllowChan),
+		DenyChan:  copySlice(info.DenyChan),
+	}
+}
+
+// Returns the default state file for a config file; "mod.toml" => "mod.state.toml".
+// The library uses it for its own config too
+func StateFileFor(configFile string) string {
+	return strings.TrimSuffix(configFile, filepath.Ext(configFile)) + ".state.toml"
+}
+
+// Returns the file runtime allow/deny changes are saved to
+func (self *moduleConfig) StateFile() string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.m.StateFile
+}
+
+// Writes the allow/deny lists to StateFile, replacing it atomically. Returns an
+// error if no StateFile is configured
+func (self *moduleConfig) SaveState() error {
+	self.mu.RLock()
+	file := self.m.StateFile
+	state := moduleState{
+		AllowUser: copySlice(self.m.AllowUser),
+		DenyUser:  copySlice(self.m.DenyUser),
+		AllowChan: copySlice(self.m.AllowChan),
+		DenyChan:  copySlice(self.m.DenyChan),
+	}
+	self.mu.RUnlock()
+
+	if file == "" {
+		return errors.New("moduleConfig.SaveState(): no StateFile configured")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := toml.NewEncoder(buf).Encode(state); err != nil {
+		return err
+	}
+
+	self.stateMu.Lock()
+	defer self.stateMu.Unlock()
+
+	return WriteAtomic(file, buf.Bytes(), 0644)
+}
+
+// Replaces the allow/deny lists with those saved in StateFile. A missing
+// StateFile is not an error and leaves the lists untouched
+func (self *moduleConfig) LoadState() error {
+	file := self.StateFile()
+	if file == "" {
+		return nil
+	}
+
+	state := new(moduleState)
+	if _, err := toml.DecodeFile(file, state); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	toLowerSlice(state.AllowUser)
+	toLowerSlice(state.DenyUser)
+	toLowerSlice(state.AllowChan)
+	toLowerSlice(state.DenyChan)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.m.AllowUser, self.m.DenyUser = state.AllowUser, state.DenyUser
+	self.m.AllowChan, self.m.DenyChan = state.AllowChan, state.DenyChan
+
+	return nil
+}
+
+// Saves state after a runtime change; errors are logged
+func (self *Module) saveState() {
+	if self.StateFile() == "" {
+		return
+	}
+
+	if err := self.SaveState(); err != nil {
+		self.Logger.Errorln("Module.SaveState():", err)
+	}
+}
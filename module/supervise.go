@@ -0,0 +1,139 @@
+package module
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Panics recovered from a trigger or command
+type PanicCount struct {
+	Trigger  string    // Event and trigger such as "PRIVMSG hi", or "COMMAND name"
+	Count    int       // Panics since the counter was last reset
+	Last     time.Time // Time of the last panic
+	Value    string    // Value passed to the last panic
+	Disabled bool      // Trigger is skipped until reset
+}
+
+// Runs `fn` for trigger `key` with a Context from handlerContext(), recovering
+// and logging a panic with its stack. Panics are counted per trigger; at
+// MaxPanics the trigger or, with OnPanic "module", the whole module is
+// disabled. Disabled triggers are not run, nor is anything once the module exits
+func (self *Module) supervise(key string, fn func(ctx context.Context)) {
+	self.panicMut.Lock()
+	if p, ok := self.panics[key]; ok && p.Disabled {
+		self.panicMut.Unlock()
+
+		return
+	}
+	self.panicMut.Unlock()
+
+	ctx, cancel := self.handlerContext(key)
+	if ctx == nil {
+		return
+	}
+	defer cancel()
+
+	defer func() {
+		if ctx.Err() == context.DeadlineExceeded {
+			self.Logger.Warnf("%v ran past its timeout of %v\n", key, self.Timeout(key))
+		}
+	}()
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		self.Logger.Errorf("Panic in %v: %v\n%s", key, r, debug.Stack())
+
+		self.panicMut.Lock()
+		p, ok := self.panics[key]
+		if !ok {
+			p = &PanicCount{Trigger: key}
+			self.panics[key] = p
+		}
+
+		p.Count++
+		p.Last = time.Now()
+		p.Value = fmt.Sprint(r)
+		count := p.Count
+		self.panicMut.Unlock()
+
+		max, onPanic := self.MaxPanics()
+		if max == 0 || count < max {
+			return
+		}
+
+		if onPanic == "module" {
+			// Counted from zero once the module is enabled again, otherwise
+			// its next panic would disable it
+			self.panicMut.Lock()
+			p.Count = 0
+			self.panicMut.Unlock()
+
+			if self.Enabled() {
+				self.Disable()
+				self.Logger.Errorf("Disabled %v after %v panics in %v\n", self.Name(), count, key)
+			}
+
+			return
+		}
+
+		self.panicMut.Lock()
+		p.Disabled = true
+		self.panicMut.Unlock()
+
+		self.Logger.Errorf("Disabled %v after %v panics\n", key, count)
+	}()
+
+	fn(ctx)
+}
+
+// Returns the panic counters sorted by trigger
+func (self *Module) Panics() []PanicCount {
+	self.panicMut.Lock()
+	defer self.panicMut.Unlock()
+
+	counts := make([]PanicCount, 0, len(self.panics))
+	for _, p := range self.panics {
+		counts = append(counts, *p)
+	}
+
+	sort.Sort(byTrigger(counts))
+
+	return counts
+}
+
+// Clears the panic counter of `trigger`, or every counter if it is empty, and
+// enables the triggers again. Returns false if there is no such counter
+func (self *Module) ResetPanics(trigger string) bool {
+	self.panicMut.Lock()
+	defer self.panicMut.Unlock()
+
+	if trigger == "" {
+		self.panics = make(map[string]*PanicCount)
+
+		return true
+	}
+
+	for key := range self.panics {
+		if strings.EqualFold(key, trigger) {
+			delete(self.panics, key)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+type byTrigger []PanicCount
+
+func (self byTrigger) Len() int           { return len(self) }
+func (self byTrigger) Less(i, j int) bool { return self[i].Trigger < self[j].Trigger }
+func (self byTrigger) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
@@ -0,0 +1,130 @@
+package module
+
+import (
+	"sort"
+	"strings"
+)
+
+// State is a read-only view of the channels and users the bot can see on a
+// network. It is only populated when tracking is enabled for the network.
+// Everything returned is a copy and safe to keep or share between handlers
+type State interface {
+	Tracking() bool // Tracking is enabled for the network
+
+	Channels() []string                      // Channels the bot is on
+	Channel(name string) *Channel            // Returns nil if the bot is not on it
+	User(nick string) *User                  // Returns nil if the nick is not seen
+	IsOn(channel, nick string) (Privs, bool) // Privileges of nick in channel
+}
+
+// Privs of a member in a channel
+type Privs struct {
+	Owner, Admin, Op, HalfOp, Voice bool
+}
+
+// Returns the prefix of the highest privilege such as "@", or an empty string
+func (self Privs) Prefix() string {
+	if prefixes := self.String(); prefixes != "" {
+		return prefixes[:1]
+	}
+
+	return ""
+}
+
+// Returns every prefix held, highest first, such as "@+"
+func (self Privs) String() string {
+	prefixes := ""
+	for i, has := range []bool{self.Owner, self.Admin, self.Op, self.HalfOp, self.Voice} {
+		if has {
+			prefixes += string("~&@%+"[i])
+		}
+	}
+
+	return prefixes
+}
+
+// Member of a channel
+type Member struct {
+	Nick  string
+	Privs Privs
+}
+
+// Channel as last seen by the bot
+type Channel struct {
+	Name    string
+	Topic   string
+	Modes   string   // Mode string such as "+ntk"
+	Key     string   // Empty if the channel has no key
+	Limit   int      // 0 if the channel has no user limit
+	Members []Member // Sorted by nick
+}
+
+// Returns the member with nick `nick`
+func (self *Channel) Member(nick string) (Member, bool) {
+	for _, m := range self.Members {
+		if strings.EqualFold(m.Nick, nick) {
+			return m, true
+		}
+	}
+
+	return Member{}, false
+}
+
+// Returns the members with at least op privileges
+func (self *Channel) Ops() []Member {
+	ops := make([]Member, 0, 5)
+	for _, m := range self.Members {
+		if m.Privs.Owner || m.Privs.Admin || m.Privs.Op {
+			ops = append(ops, m)
+		}
+	}
+
+	return ops
+}
+
+// User as last seen by the bot
+type User struct {
+	Nick, Ident, Host, Name string
+
+	Account  string           // Services account, empty if unknown
+	Away     bool             // Marked away by away-notify, RPL_AWAY or WHO
+	AwayMsg  string           // Away message if known
+	Modes    string           // User modes; only known for the bot itself
+	Channels map[string]Privs // Lowered channel names shared with the bot
+}
+
+// Returns the Source that would match the user
+func (self *User) Source() Source {
+	return Source{
+		Nick:    self.Nick,
+		Ident:   self.Ident,
+		Host:    self.Host,
+		Account: self.Account,
+	}
+}
+
+// Returns the State of a network or nil if there is no such network
+func (self *Module) State(network string) State {
+	if self.Client == nil {
+		return nil
+	}
+
+	if client := self.Client(network); client != nil {
+		return client
+	}
+
+	return nil
+}
+
+type byNick []Member
+
+func (self byNick) Len() int { return len(self) }
+func (self byNick) Less(i, j int) bool {
+	return strings.ToLower(self[i].Nick) < strings.ToLower(self[j].Nick)
+}
+func (self byNick) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
+
+// Sorts members by nick
+func SortMembers(members []Member) {
+	sort.Sort(byNick(members))
+}
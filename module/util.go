@@ -3,6 +3,9 @@ package module
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -75,6 +78,11 @@ func toLowerSlice(list []string) {
 	}
 }
 
+// Returns true if 'target' is a channel name
+func isChannel(target string) bool {
+	return target != "" && strings.IndexByte("#&+!", target[0]) != -1
+}
+
 // Helper function to match named groups
 func matchGroups(reg *regexp.Regexp, s string) (map[string]string, error) {
 	groups := make(map[string]string)
@@ -92,3 +100,40 @@ func matchGroups(reg *regexp.Regexp, s string) (map[string]string, error) {
 
 	return groups, nil
 }
+
+// Writes 'data' to a temporary file next to 'name' and renames it over 'name'
+// so readers never see a partially written file
+func WriteAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		os.Remove(tmp.Name())
+
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
@@ -6,6 +6,8 @@ import (
 	"sync"
 )
 
+//go:generate go run gen_numerics.go
+
 type Event string
 
 // IRC events to trigger on
@@ -36,8 +38,27 @@ const (
 	E_VHOST        Event = "VHOST"
 	E_WHO          Event = "WHO"
 	E_WHOIS        Event = "WHOIS"
+
+	// Every line received, before its own event. The trigger is the text
+	E_ANY Event = "*"
+	// Every raw line sent or received, see Message.Sent. The trigger is the
+	// whole line
+	E_RAW Event = "RAW"
+	// A BATCH once it ends, with every line in Message.Batch. The trigger is
+	// the batch type
+	E_BATCH Event = "BATCH"
 )
 
+// Returns a name for documentation such as "ERR_NICKNAMEINUSE (433)" for
+// numerics and the event itself otherwise
+func (self Event) Name() string {
+	if name, ok := numericNames[self]; ok {
+		return name + " (" + string(self) + ")"
+	}
+
+	return string(self)
+}
+
 // Events is a slice of Events which are registered when irclibrary.Connect()
 // is called. This is export primarily for the use of irclibrary and should not
 // need to be modified by the user
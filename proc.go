@@ -0,0 +1,537 @@
+package irclib
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/crimsonvoid/irclib/module"
+)
+
+// Subprocess modules are a TOML file and an executable in the modules
+// directory. The TOML holds the usual ModuleInfo keys plus procInfo. The
+// process speaks line-delimited JSON over stdio: the bot writes procEvents to
+// its stdin and it writes procActions to its stdout, for example
+//
+//	-> {"type":"event","network":"libera","event":"PRIVMSG","nick":"alice","target":"#bots","text":"!hi","args":["#bots","!hi"]}
+//	<- {"action":"privmsg","network":"libera","target":"#bots","text":"hi alice"}
+//
+// Lines written to stderr are logged as warnings. Stdin is closed after an
+// "exit" event; a process that has not exited within procExitWait is killed
+type procInfo struct {
+	Exec   string   // Executable, defaults to the TOML file without ".toml"
+	Args   []string // Arguments passed to the executable
+	Events []string // Events sent to the process, defaults to PRIVMSG
+
+	// Restart the process when it exits while the module is running. The
+	// delay doubles from RestartDelay up to RestartMax seconds. RestartTries
+	// limits attempts in a row, 0 retries forever
+	Restart      bool
+	RestartDelay int
+	RestartMax   int
+	RestartTries int
+}
+
+// Written to the process, one per line
+type procEvent struct {
+	Type    string            `json:"type"` // "start", "event", "reconnecting", "reconnected" or "exit"
+	Module  string            `json:"module,omitempty"`
+	Network string            `json:"network,omitempty"`
+	Event   string            `json:"event,omitempty"`
+	Nick    string            `json:"nick,omitempty"`
+	Ident   string            `json:"ident,omitempty"`
+	Host    string            `json:"host,omitempty"`
+	Account string            `json:"account,omitempty"`
+	Target  string            `json:"target,omitempty"`
+	Text    string            `json:"text,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Raw     string            `json:"raw,omitempty"`
+	Time    string            `json:"time,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	History bool              `json:"history,omitempty"` // Replayed by the server, not live
+}
+
+// Read from the process, one per line
+type procAction struct {
+	Action  string `json:"action"` // "privmsg", "notice", "action", "join", "part", "kick", "topic", "raw" or "log"
+	Network string `json:"network"`
+	Target  string `json:"target"` // Nick or channel of privmsg, notice, action, join, part, kick, topic
+	Nick    string `json:"nick"`   // Nick to kick
+	Text    string `json:"text"`   // Message, part or kick reason, topic, raw line or log text
+	Key     string `json:"key"`    // Channel key to join with
+	Level   string `json:"level"`  // "error", "warn", "info" or "debug" for log
+
+	Tags map[string]string `json:"tags"` // Client-only tags for privmsg and notice
+}
+
+// Time a process has to exit after its "exit" event
+var procExitWait = 5 * time.Second
+
+// A process that runs longer than this before exiting resets the restart delay
+const procStableTime = time.Minute
+
+type procModule struct {
+	mod     *module.Module
+	name    string
+	exec    string
+	info    procInfo
+	restart backoff
+
+	in      chan []byte // JSON lines waiting to be written to stdin, per process
+	inMut   sync.Mutex
+	quit    chan struct{} // Closed to stop the process and supervisor
+	done    chan struct{} // Closed once the supervisor returns
+	running bool
+	mut     sync.Mutex
+}
+
+// Returns a Module for every subprocess module in `dir`. Errors are keyed by
+// file name
+func LoadModuleDir(dir string) ([]*module.Module, map[string]error) {
+	mods := make([]*module.Module, 0, 5)
+	errMap := make(map[string]error)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		errMap[dir] = err
+
+		return nil, errMap
+	}
+
+	for _, fi := range files {
+		name := fi.Name()
+		if fi.IsDir() || filepath.Ext(name) != ".toml" || strings.HasSuffix(name, ".state.toml") {
+			continue
+		}
+
+		mod, err := NewProcModule(filepath.Join(dir, name))
+		if err != nil {
+			errMap[name] = err
+
+			continue
+		}
+
+		mods = append(mods, mod)
+	}
+
+	return mods, errMap
+}
+
+// Returns a Module that runs the executable configured in `configFile` as a
+// subprocess while the module is running
+func NewProcModule(configFile string) (*module.Module, error) {
+	info := new(procInfo)
+	if _, err := toml.DecodeFile(configFile, info); err != nil {
+		return nil, err
+	}
+
+	execPath := info.Exec
+	if execPath == "" {
+		execPath = strings.TrimSuffix(configFile, ".toml")
+	} else if !filepath.IsAbs(execPath) {
+		execPath = filepath.Join(filepath.Dir(configFile), execPath)
+	}
+
+	fi, err := os.Stat(execPath)
+	if err != nil {
+		return nil, fmt.Errorf("No executable for %v: %v", configFile, err)
+	}
+	if fi.IsDir() || fi.Mode()&0111 == 0 {
+		return nil, fmt.Errorf("%v is not executable", execPath)
+	}
+
+	if len(info.Events) == 0 {
+		info.Events = []string{string(module.E_PRIVMSG)}
+	}
+
+	if info.RestartDelay <= 0 {
+		info.RestartDelay = 1
+	}
+	if info.RestartMax < info.RestartDelay {
+		info.RestartMax = 300
+	}
+
+	mod, err := module.New(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &procModule{
+		mod:  mod,
+		name: mod.Name(),
+		exec: execPath,
+		info: *info,
+		restart: backoff{
+			Enabled: info.Restart,
+			Delay:   time.Duration(info.RestartDelay) * time.Second,
+			Max:     time.Duration(info.RestartMax) * time.Second,
+			Jitter:  0.1,
+			Tries:   info.RestartTries,
+		},
+	}
+
+	// Hooks are called with the module locked; they must not call methods of mod
+	mod.Connected = p.start
+	mod.Disconnect = p.stop
+	mod.Reconnecting = func(network string) error {
+		p.send(&procEvent{Type: "reconnecting", Network: network})
+
+		return nil
+	}
+	mod.Reconnected = func(network string) error {
+		p.send(&procEvent{Type: "reconnected", Network: network})
+
+		return nil
+	}
+
+	all := regexp.MustCompile("")
+	for _, event := range info.Events {
+		mod.On(module.Event(strings.ToUpper(event)), all, p.event)
+	}
+
+	return mod, nil
+}
+
+// Starts the process and its supervisor
+func (self *procModule) start() error {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	if self.running {
+		return errors.New("Process is already running")
+	}
+
+	wait, err := self.spawn()
+	if err != nil {
+		return err
+	}
+
+	self.running = true
+	self.quit = make(chan struct{})
+	self.done = make(chan struct{})
+
+	go self.supervise(wait, self.quit, self.done)
+
+	return nil
+}
+
+// Asks the process to exit, killing it if it does not
+func (self *procModule) stop() error {
+	self.mut.Lock()
+	if !self.running {
+		self.mut.Unlock()
+
+		return nil
+	}
+
+	self.running = false
+	self.send(&procEvent{Type: "exit"})
+	close(self.quit)
+	done := self.done
+	self.mut.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(procExitWait + time.Second):
+		return fmt.Errorf("Process %v did not stop", self.exec)
+	}
+}
+
+// Starts the process and returns a function that waits for it to exit, killing
+// it if `quit` is closed first
+func (self *procModule) spawn() (func(quit chan struct{}) error, error) {
+	cmd := exec.Command(self.exec, self.info.Args...)
+	cmd.Dir = filepath.Dir(self.exec)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Unable to start %v: %v", self.exec, err)
+	}
+
+	self.mod.Logger.Infof("Started %v (pid %v)\n", self.exec, cmd.Process.Pid)
+
+	readers := new(sync.WaitGroup)
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		self.readActions(stdout)
+	}()
+	go func() {
+		defer readers.Done()
+		self.readStderr(stderr)
+	}()
+
+	// Lines queued for a process that exited are not written to the next one
+	in := make(chan []byte, 256)
+	self.inMut.Lock()
+	self.in = in
+	self.inMut.Unlock()
+
+	stopWriting := make(chan struct{})
+	go self.writeEvents(stdin, in, stopWriting)
+
+	self.send(&procEvent{Type: "start", Module: self.name})
+
+	wait := func(quit chan struct{}) error {
+		exited := make(chan error, 1)
+		go func() {
+			readers.Wait()
+			exited <- cmd.Wait()
+		}()
+
+		var err error
+		select {
+		case err = <-exited:
+		case <-quit:
+			close(stopWriting)
+			stopWriting = nil
+
+			select {
+			case err = <-exited:
+			case <-time.After(procExitWait):
+				self.mod.Logger.Warnf("Killing %v after %v\n", self.exec, procExitWait)
+				cmd.Process.Kill()
+				err = <-exited
+			}
+		}
+
+		if stopWriting != nil {
+			close(stopWriting)
+		}
+
+		return err
+	}
+
+	return wait, nil
+}
+
+// Waits for the process to exit and restarts it with backoff while running
+func (self *procModule) supervise(wait func(chan struct{}) error, quit, done chan struct{}) {
+	defer close(done)
+
+	attempt := 0
+	for {
+		started := time.Now()
+		err := wait(quit)
+
+		select {
+		case <-quit:
+			self.mod.Logger.Infof("Stopped %v\n", self.exec)
+
+			return
+		default:
+		}
+
+		self.mod.Logger.Errorf("Process %v exited: %v\n", self.exec, err)
+
+		if time.Since(started) > procStableTime {
+			attempt = 0
+		}
+
+		for {
+			if !self.restart.Enabled || (self.restart.Tries != 0 && attempt >= self.restart.Tries) {
+				self.mod.Logger.Errorf("Not restarting %v\n", self.exec)
+
+				self.mut.Lock()
+				self.running = false
+				self.mut.Unlock()
+
+				// Events are dropped quietly until the process is started again
+				self.inMut.Lock()
+				self.in = nil
+				self.inMut.Unlock()
+
+				return
+			}
+
+			delay := self.restart.next(attempt)
+			attempt++
+			self.mod.Logger.Infof("Restarting %v in %v\n", self.exec, delay)
+
+			select {
+			case <-quit:
+				return
+			case <-time.After(delay):
+			}
+
+			if wait, err = self.spawn(); err == nil {
+				break
+			}
+
+			self.mod.Logger.Errorln(err)
+		}
+	}
+}
+
+// Queues a line for the process; dropped if the process is not keeping up,
+// was never started or will not be restarted
+func (self *procModule) send(ev *procEvent) {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		self.mod.Logger.Errorln(err)
+
+		return
+	}
+
+	self.inMut.Lock()
+	in := self.in
+	self.inMut.Unlock()
+
+	if in == nil {
+		return
+	}
+
+	select {
+	case in <- b:
+	default:
+		self.mod.Logger.Warnf("Dropped %v event for %v, queue full\n", ev.Type, self.exec)
+	}
+}
+
+func (self *procModule) writeEvents(stdin io.WriteCloser, in chan []byte, stop chan struct{}) {
+	defer stdin.Close()
+
+	for {
+		select {
+		case b := <-in:
+			if _, err := stdin.Write(append(b, '\n')); err != nil {
+				return
+			}
+		case <-stop:
+			// Flush what is queued, such as the exit event, then close stdin
+			for {
+				select {
+				case b := <-in:
+					if _, err := stdin.Write(append(b, '\n')); err != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (self *procModule) readStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		self.mod.Logger.Warnln(scanner.Text())
+	}
+}
+
+func (self *procModule) readActions(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+
+	for scanner.Scan() {
+		action := new(procAction)
+		if err := json.Unmarshal(scanner.Bytes(), action); err != nil {
+			self.mod.Logger.Warnf("Invalid action %q: %v\n", scanner.Text(), err)
+
+			continue
+		}
+
+		if err := self.do(action); err != nil {
+			self.mod.Logger.Warnf("Action %v: %v\n", action.Action, err)
+		}
+	}
+}
+
+// Sends an event from IRC to the process
+func (self *procModule) event(msg *module.Message) {
+	self.send(&procEvent{
+		Type:    "event",
+		Network: msg.Network,
+		Event:   msg.Cmd,
+		Nick:    msg.Nick,
+		Ident:   msg.Ident,
+		Host:    msg.Host,
+		Account: msg.Account,
+		Target:  msg.Target(),
+		Text:    msg.Text(),
+		Args:    msg.Args,
+		Raw:     msg.Raw,
+		Time:    msg.Time.Format(time.RFC3339Nano),
+		Tags:    msg.Tags,
+		History: msg.IsHistory(),
+	})
+}
+
+// Carries out an action from the process
+func (self *procModule) do(action *procAction) error {
+	if action.Action == "log" {
+		switch strings.ToLower(action.Level) {
+		case "error":
+			self.mod.Logger.Errorln(action.Text)
+		case "warn":
+			self.mod.Logger.Warnln(action.Text)
+		case "debug":
+			self.mod.Logger.Debugln(action.Text)
+		default:
+			self.mod.Logger.Infoln(action.Text)
+		}
+
+		return nil
+	}
+
+	if self.mod.Client == nil {
+		return errors.New("Module is not registered")
+	}
+
+	client := self.mod.Client(action.Network)
+	if client == nil {
+		return fmt.Errorf("No such network %q", action.Network)
+	}
+
+	switch action.Action {
+	case "privmsg":
+		client.PrivmsgTags(action.Target, action.Text, action.Tags)
+	case "notice":
+		client.NoticeTags(action.Target, action.Text, action.Tags)
+	case "action":
+		client.Action(action.Target, action.Text)
+	case "join":
+		if action.Key != "" {
+			client.Join(action.Target, action.Key)
+		} else {
+			client.Join(action.Target)
+		}
+	case "part":
+		client.Part(action.Target, action.Text)
+	case "kick":
+		client.Kick(action.Target, action.Nick, action.Text)
+	case "topic":
+		client.Topic(action.Target, action.Text)
+	case "raw":
+		client.Raw(action.Text)
+	default:
+		return errors.New("Unknown action")
+	}
+
+	return nil
+}
@@ -0,0 +1,491 @@
+package irclib
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crimsonvoid/irclib/module"
+	irc "github.com/fluffle/goirc/client"
+)
+
+// Servers answer queries in the order they were sent, so each reply belongs to
+// the oldest query in flight that accepts it. Every query sent on the wire is
+// tracked, including those sent by goirc, the library or with Raw(), so their
+// replies are not mistaken for ours. A query that timed out stays as a
+// tombstone until its end arrives so late replies are not handed to the next
+// query
+
+const (
+	replyData    = iota
+	replyEnd     // Last reply of the query
+	replyErr     // Ends the query with a ReplyError
+	replyFail    // Fails the query with a ReplyError once its end arrives
+	replyTrailer // Optional reply sent straight after the end
+)
+
+type replyRule struct {
+	key  int // Argument holding the query's target, -1 if it has none
+	kind int
+}
+
+// Replies to each query command, by numeric
+var queryReplies = map[string]map[string]replyRule{
+	"WHOIS": {
+		"276": {1, replyData}, // RPL_WHOISCERTFP
+		"301": {1, replyData}, // RPL_AWAY
+		"311": {1, replyData}, // RPL_WHOISUSER
+		"312": {1, replyData}, // RPL_WHOISSERVER
+		"313": {1, replyData}, // RPL_WHOISOPERATOR
+		"317": {1, replyData}, // RPL_WHOISIDLE
+		"319": {1, replyData}, // RPL_WHOISCHANNELS
+		"330": {1, replyData}, // RPL_WHOISACCOUNT
+		"338": {1, replyData}, // RPL_WHOISACTUALLY
+		"378": {1, replyData}, // RPL_WHOISHOST
+		"379": {1, replyData}, // RPL_WHOISMODES
+		"671": {1, replyData}, // RPL_WHOISSECURE
+		"318": {1, replyEnd},  // RPL_ENDOFWHOIS
+		"401": {1, replyFail}, // ERR_NOSUCHNICK, followed by RPL_ENDOFWHOIS
+		"402": {1, replyErr},  // ERR_NOSUCHSERVER
+		"431": {-1, replyErr}, // ERR_NONICKNAMEGIVEN
+	},
+	"WHO": {
+		"352": {-1, replyData}, // RPL_WHOREPLY
+		"354": {-1, replyData}, // RPL_WHOSPCRPL
+		"315": {1, replyEnd},   // RPL_ENDOFWHO
+	},
+	"NAMES": {
+		"353": {2, replyData}, // RPL_NAMREPLY
+		"366": {1, replyEnd},  // RPL_ENDOFNAMES
+	},
+	"LIST": {
+		"321": {-1, replyData}, // RPL_LISTSTART
+		"322": {-1, replyData}, // RPL_LIST
+		"323": {-1, replyEnd},  // RPL_LISTEND
+	},
+	"MODE": {
+		"324": {1, replyEnd},     // RPL_CHANNELMODEIS
+		"329": {1, replyTrailer}, // RPL_CREATIONTIME
+		"403": {1, replyErr},     // ERR_NOSUCHCHANNEL
+		"442": {1, replyErr},     // ERR_NOTONCHANNEL
+		"477": {1, replyErr},     // ERR_NOCHANMODES
+	},
+}
+
+// Time an ended query waits for its trailer
+const queryTrailerWait = time.Second
+
+// A query in flight. done is nil for queries we did not send or that timed out
+type query struct {
+	cmd, key string
+	lines    []*irc.Line
+	done     chan error
+	err      error // From a replyFail, returned once the end arrives
+	ended    bool  // End seen, waiting for a trailer
+}
+
+// Returns the lowered target of a query command and false if it is not a query
+func queryKey(cmd string, args []string) (string, bool) {
+	if _, ok := queryReplies[cmd]; !ok {
+		return "", false
+	}
+
+	switch {
+	case cmd == "LIST":
+		return "", true
+	case len(args) == 0:
+		return "", cmd != "MODE"
+	case cmd == "MODE":
+		// Only "MODE #channel" asks for modes
+		return strings.ToLower(args[0]), len(args) == 1 && isChannel(args[0])
+	case cmd == "WHOIS":
+		// WHOIS [server] nick
+		return strings.ToLower(args[len(args)-1]), true
+	}
+
+	return strings.ToLower(args[0]), true
+}
+
+// Tracks queries sent and hands replies to them. Called with every line on the
+// wire
+func (self *Session) routeQuery(raw string, sent bool) {
+	self.queryMut.Lock()
+	defer self.queryMut.Unlock()
+
+	if !sent && len(self.queries) == 0 {
+		return
+	}
+
+	line := irc.ParseLine(raw)
+	if line == nil {
+		return
+	}
+
+	if sent {
+		cmd := strings.ToUpper(line.Cmd)
+		key, ok := queryKey(cmd, line.Args)
+		if !ok {
+			return
+		}
+
+		var q *query
+		for i, w := range self.waiting {
+			if w.cmd == cmd && w.key == key {
+				q = w
+				self.waiting = append(self.waiting[:i], self.waiting[i+1:]...)
+				break
+			}
+		}
+
+		if q == nil {
+			q = &query{cmd: cmd, key: key}
+		}
+
+		self.queries = append(self.queries, q)
+
+		return
+	}
+
+	// A query that ended only takes its trailer straight after the end
+	for _, q := range append([]*query(nil), self.queries...) {
+		if !q.ended {
+			continue
+		}
+
+		if rule, ok := queryReplies[q.cmd][line.Cmd]; ok && rule.kind == replyTrailer && q.accepts(rule, line) {
+			q.lines = append(q.lines, line)
+			self.finishQuery(q, nil)
+
+			return
+		}
+
+		self.finishQuery(q, nil)
+	}
+
+	for _, q := range self.queries {
+		rule, ok := queryReplies[q.cmd][line.Cmd]
+		if !ok || q.ended || rule.kind == replyTrailer || !q.accepts(rule, line) {
+			continue
+		}
+
+		switch rule.kind {
+		case replyData:
+			q.lines = append(q.lines, line)
+		case replyFail:
+			if q.err == nil {
+				q.err = replyError(line)
+			}
+		case replyEnd:
+			q.lines = append(q.lines, line)
+
+			if q.err != nil {
+				self.finishQuery(q, q.err)
+			} else if q.hasTrailer() {
+				q.ended = true
+				time.AfterFunc(queryTrailerWait, func() {
+					self.queryMut.Lock()
+					self.finishQuery(q, nil)
+					self.queryMut.Unlock()
+				})
+			} else {
+				self.finishQuery(q, nil)
+			}
+		case replyErr:
+			self.finishQuery(q, replyError(line))
+		}
+
+		return
+	}
+}
+
+// Returns the error an error numeric reports
+func replyError(line *irc.Line) error {
+	return &module.ReplyError{
+		Code: module.Event(line.Cmd),
+		Text: replyArg(line, len(line.Args)-1),
+	}
+}
+
+// Returns true if `line` is for this query's target
+func (self *query) accepts(rule replyRule, line *irc.Line) bool {
+	return rule.key == -1 || self.key == "" || strings.EqualFold(replyArg(line, rule.key), self.key)
+}
+
+func (self *query) hasTrailer() bool {
+	for _, rule := range queryReplies[self.cmd] {
+		if rule.kind == replyTrailer {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Removes a query and hands its result to the caller. Locked by callee
+func (self *Session) finishQuery(q *query, err error) {
+	for i, other := range self.queries {
+		if other == q {
+			self.queries = append(self.queries[:i], self.queries[i+1:]...)
+			break
+		}
+	}
+
+	if q.done != nil {
+		q.done <- err
+		q.done = nil
+	}
+}
+
+// Fails every query in flight, such as after disconnecting
+func (self *Session) failQueries(err error) {
+	self.queryMut.Lock()
+	defer self.queryMut.Unlock()
+
+	for len(self.queries) != 0 {
+		self.finishQuery(self.queries[0], err)
+	}
+
+	for _, q := range self.waiting {
+		if q.done != nil {
+			q.done <- err
+		}
+	}
+	self.waiting = nil
+}
+
+// Sends `raw` and returns the replies to it
+func (self *Session) query(ctx context.Context, cmd, key, raw string) ([]*irc.Line, error) {
+	if !self.Connected() {
+		return nil, errors.New("Not connected to " + self.Name)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, module.QueryTimeout)
+		defer cancel()
+	}
+
+	q := &query{cmd: cmd, key: strings.ToLower(key), done: make(chan error, 1)}
+	if cmd == "LIST" {
+		q.key = ""
+	}
+
+	self.queryMut.Lock()
+	self.waiting = append(self.waiting, q)
+	self.queryMut.Unlock()
+
+	done := q.done
+	self.Conn.Raw(raw)
+
+	select {
+	case err := <-done:
+		self.queryMut.Lock()
+		defer self.queryMut.Unlock()
+
+		return q.lines, err
+	case <-ctx.Done():
+		self.abandonQuery(q)
+
+		return nil, ctx.Err()
+	}
+}
+
+// Stops waiting for a query. One already sent stays as a tombstone taking its
+// late replies until its end arrives or another module.QueryTimeout passes, in
+// case the server never sends one; one not
+// yet sent is tracked like queries we did not send once it is
+func (self *Session) abandonQuery(q *query) {
+	self.queryMut.Lock()
+	defer self.queryMut.Unlock()
+
+	q.done = nil
+	for i, w := range self.waiting {
+		if w == q {
+			self.waiting = append(self.waiting[:i], self.waiting[i+1:]...)
+
+			return
+		}
+	}
+
+	time.AfterFunc(module.QueryTimeout, func() {
+		self.queryMut.Lock()
+		self.finishQuery(q, nil)
+		self.queryMut.Unlock()
+	})
+}
+
+// Returns the argument at `i` or an empty string
+func replyArg(line *irc.Line, i int) string {
+	if i >= 0 && i < len(line.Args) {
+		return line.Args[i]
+	}
+
+	return ""
+}
+
+// Sends WHOIS and returns the user's details
+func (self *Session) Whois(ctx context.Context, nick string) (*module.WhoisReply, error) {
+	lines, err := self.query(ctx, "WHOIS", nick, "WHOIS "+nick)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &module.WhoisReply{Nick: nick}
+	for _, line := range lines {
+		switch line.Cmd {
+		case "311": // me nick ident host * :name
+			w.Nick, w.Ident, w.Host = replyArg(line, 1), replyArg(line, 2), replyArg(line, 3)
+			w.Name = replyArg(line, 5)
+		case "312": // me nick server :info
+			w.Server, w.ServerInfo = replyArg(line, 2), replyArg(line, 3)
+		case "313":
+			w.Oper = true
+		case "317": // me nick idle signon :seconds idle, signon time
+			idle, _ := strconv.Atoi(replyArg(line, 2))
+			w.Idle = time.Duration(idle) * time.Second
+
+			if signon, err := strconv.ParseInt(replyArg(line, 3), 10, 64); err == nil && len(line.Args) > 4 {
+				w.SignOn = time.Unix(signon, 0)
+			}
+		case "319": // me nick :@#chan +#other
+			w.Channels = append(w.Channels, strings.Fields(replyArg(line, 2))...)
+		case "330": // me nick account :is logged in as
+			w.Account = replyArg(line, 2)
+		case "301": // me nick :away message
+			w.Away, w.AwayMsg = true, replyArg(line, 2)
+		case "671":
+			w.Secure = true
+		}
+	}
+
+	return w, nil
+}
+
+// Sends WHO and returns a reply per user matching `mask`
+func (self *Session) Who(ctx context.Context, mask string) ([]module.WhoReply, error) {
+	lines, err := self.query(ctx, "WHO", mask, "WHO "+mask)
+	if err != nil {
+		return nil, err
+	}
+
+	types := self.ModeTypes()
+	replies := make([]module.WhoReply, 0, len(lines))
+	for _, line := range lines {
+		// me channel ident host server nick flags :hops name
+		if line.Cmd != "352" || len(line.Args) < 8 {
+			continue
+		}
+
+		flags := line.Args[6]
+		privs, _ := types.ParsePrefixes(strings.TrimLeft(flags, "HG*"))
+		hops, name := line.Args[7], ""
+		if i := strings.IndexByte(hops, ' '); i != -1 {
+			hops, name = hops[:i], hops[i+1:]
+		}
+		n, _ := strconv.Atoi(hops)
+
+		replies = append(replies, module.WhoReply{
+			Channel: line.Args[1],
+			Ident:   line.Args[2],
+			Host:    line.Args[3],
+			Server:  line.Args[4],
+			Nick:    line.Args[5],
+			Away:    strings.HasPrefix(flags, "G"),
+			Oper:    strings.Contains(flags, "*"),
+			Privs:   privs,
+			Hops:    n,
+			Name:    name,
+		})
+	}
+
+	return replies, nil
+}
+
+// Sends NAMES and returns the members of `channel`
+func (self *Session) Names(ctx context.Context, channel string) ([]module.Member, error) {
+	lines, err := self.query(ctx, "NAMES", channel, "NAMES "+channel)
+	if err != nil {
+		return nil, err
+	}
+
+	types := self.ModeTypes()
+	members := make([]module.Member, 0, 20)
+	for _, line := range lines {
+		// me symbol channel :@nick +nick nick
+		if line.Cmd != "353" {
+			continue
+		}
+
+		for _, name := range strings.Fields(replyArg(line, 3)) {
+			privs, nick := types.ParsePrefixes(name)
+
+			// userhost-in-names sends nick!ident@host
+			if i := strings.IndexByte(nick, '!'); i != -1 {
+				nick = nick[:i]
+			}
+
+			members = append(members, module.Member{Nick: nick, Privs: privs})
+		}
+	}
+
+	module.SortMembers(members)
+
+	return members, nil
+}
+
+// Sends LIST and returns every channel the server lists
+func (self *Session) ListChannels(ctx context.Context) ([]module.ListReply, error) {
+	lines, err := self.query(ctx, "LIST", "", "LIST")
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make([]module.ListReply, 0, len(lines))
+	for _, line := range lines {
+		// me channel users :topic
+		if line.Cmd != "322" {
+			continue
+		}
+
+		users, _ := strconv.Atoi(replyArg(line, 2))
+		replies = append(replies, module.ListReply{
+			Channel: replyArg(line, 1),
+			Users:   users,
+			Topic:   replyArg(line, 3),
+		})
+	}
+
+	return replies, nil
+}
+
+// Sends MODE and returns the modes of `channel`
+func (self *Session) Mode(ctx context.Context, channel string) (*module.ModeReply, error) {
+	// Replies to user modes are not tracked
+	if !isChannel(channel) {
+		return nil, errors.New(channel + " is not a channel")
+	}
+
+	lines, err := self.query(ctx, "MODE", channel, "MODE "+channel)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &module.ModeReply{Channel: channel}
+	for _, line := range lines {
+		switch line.Cmd {
+		case "324": // me channel modes params...
+			reply.Modes = replyArg(line, 2)
+			if len(line.Args) > 3 {
+				reply.Params = append([]string{}, line.Args[3:]...)
+			}
+		case "329": // me channel created
+			if created, err := strconv.ParseInt(replyArg(line, 2), 10, 64); err == nil {
+				reply.Created = time.Unix(created, 0)
+			}
+		}
+	}
+
+	return reply, nil
+}
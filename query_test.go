@@ -0,0 +1,97 @@
+package irclib
+
+import (
+	"testing"
+
+	"github.com/crimsonvoid/irclib/module"
+)
+
+// A query sent as query() would, with the channel its result arrives on
+type sentQuery struct {
+	*query
+	done chan error
+}
+
+func sendQuery(s *Session, cmd, key, raw string) sentQuery {
+	q := &query{cmd: cmd, key: key, done: make(chan error, 1)}
+
+	s.queryMut.Lock()
+	s.waiting = append(s.waiting, q)
+	s.queryMut.Unlock()
+
+	s.routeQuery(raw, true)
+
+	return sentQuery{q, q.done}
+}
+
+// Returns the result of a query if it finished
+func queryResult(q sentQuery) (error, bool) {
+	select {
+	case err := <-q.done:
+		return err, true
+	default:
+		return nil, false
+	}
+}
+
+func TestQueryNoSuchNick(t *testing.T) {
+	s := new(Session)
+
+	q := sendQuery(s, "WHOIS", "ghost", "WHOIS ghost")
+	s.routeQuery(":irc.test 401 bot ghost :No such nick/channel", false)
+
+	if _, ok := queryResult(q); ok {
+		t.Fatal("WHOIS finished before RPL_ENDOFWHOIS")
+	}
+
+	s.routeQuery(":irc.test 318 bot ghost :End of /WHOIS list", false)
+
+	err, ok := queryResult(q)
+	if !ok {
+		t.Fatal("WHOIS did not finish at RPL_ENDOFWHOIS")
+	}
+	if replyErr, isReply := err.(*module.ReplyError); !isReply || replyErr.Code != "401" {
+		t.Errorf("WHOIS failed with %v, want ERR_NOSUCHNICK", err)
+	}
+
+	// The next WHOIS for the nick is not ended by the earlier reply
+	next := sendQuery(s, "WHOIS", "ghost", "WHOIS ghost")
+	s.routeQuery(":irc.test 311 bot ghost user host * :Real Name", false)
+	s.routeQuery(":irc.test 318 bot ghost :End of /WHOIS list", false)
+
+	if err, ok := queryResult(next); !ok || err != nil || len(next.lines) != 2 {
+		t.Errorf("Next WHOIS = %v, %v with %v lines, want 2 lines", err, ok, len(next.lines))
+	}
+}
+
+func TestQueryTimedOutKeepsReplies(t *testing.T) {
+	s := new(Session)
+
+	late := sendQuery(s, "WHOIS", "nick", "WHOIS nick")
+	s.abandonQuery(late.query)
+
+	q := sendQuery(s, "WHOIS", "nick", "WHOIS nick")
+
+	// Replies to the query that timed out
+	s.routeQuery(":irc.test 311 bot nick old host * :Old", false)
+	s.routeQuery(":irc.test 318 bot nick :End of /WHOIS list", false)
+
+	if _, ok := queryResult(q); ok {
+		t.Fatal("WHOIS finished with the replies of the one that timed out")
+	}
+
+	s.routeQuery(":irc.test 311 bot nick new host * :New", false)
+	s.routeQuery(":irc.test 318 bot nick :End of /WHOIS list", false)
+
+	err, ok := queryResult(q)
+	if !ok || err != nil {
+		t.Fatalf("WHOIS = %v, %v, want its own replies", err, ok)
+	}
+	if len(q.lines) != 2 || q.lines[0].Args[2] != "new" {
+		t.Errorf("WHOIS got %v lines starting %q, want its own", len(q.lines), q.lines[0].Raw)
+	}
+
+	if len(s.queries) != 0 {
+		t.Errorf("%v queries left in flight", len(s.queries))
+	}
+}
@@ -0,0 +1,165 @@
+package irclib
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/crimsonvoid/console/styles"
+)
+
+// Exponential backoff settings used when reconnecting
+type backoff struct {
+	Enabled bool
+	Delay   time.Duration // Initial delay
+	Max     time.Duration // Upper bound of the delay before jitter
+	Jitter  float64       // Fraction of the delay to randomly add
+	Tries   int           // Maximum attempts, 0 is unlimited
+}
+
+// Returns the delay to wait before attempt number `attempt`, starting at 0
+func (self *backoff) next(attempt int) time.Duration {
+	delay := self.Delay
+	for i := 0; i < attempt && delay < self.Max; i++ {
+		delay *= 2
+	}
+
+	if delay > self.Max {
+		delay = self.Max
+	}
+
+	if self.Jitter > 0 {
+		delay += time.Duration(rand.Float64() * self.Jitter * float64(delay))
+	}
+
+	return delay
+}
+
+// Re-dials the server with backoff after the connection is lost. Modules are
+// notified with Module.PreReconnect() before the first attempt; once the
+// server welcomes us again the CONNECTED handler rejoins channels and calls
+// Session.reconnected(). If the link drops again before that, retrying starts
+// over without notifying modules twice
+func (self *Session) startReconnect() {
+	m := self.manager
+
+	self.mut.Lock()
+	if !m.Running() || self.retrying || !self.reconnect.Enabled {
+		self.mut.Unlock()
+
+		return
+	}
+
+	notify := !self.reconnecting
+	self.reconnecting = true
+	self.retrying = true
+	if self.stopRetry == nil {
+		self.stopRetry = make(chan bool)
+	}
+	stop := self.stopRetry
+	b := self.reconnect
+	self.mut.Unlock()
+
+	server := self.Conn.Config().Server
+	if !notify {
+		m.core.Logger.Warnf("Lost connection to %v (%v) before registering\n", self.Name, server)
+	} else {
+		consLog.Println(styles.Red.Fg("Lost connection to %v (%v)", self.Name, server))
+		m.core.Logger.Warnf("Lost connection to %v (%v)\n", self.Name, server)
+
+		for _, mod := range m.Modules() {
+			if err := mod.PreReconnect(self.Name); err != nil {
+				m.core.Logger.Errorf("%v.PreReconnect() error: %v\n", mod.Name(), err)
+			}
+		}
+	}
+
+	for attempt := 0; b.Tries == 0 || attempt < b.Tries; attempt++ {
+		delay := b.next(attempt)
+		m.core.Logger.Infof("Reconnecting to %v in %v (attempt %v)\n",
+			self.Name, delay, attempt+1)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+
+		if !m.Running() {
+			self.stopReconnect()
+
+			return
+		}
+
+		// Cleared before dialing so a link lost after connecting, which may
+		// happen before Connect() returns, starts retrying again
+		self.mut.Lock()
+		self.applyPending()
+		self.retrying = false
+		self.mut.Unlock()
+
+		if err := self.Conn.Connect(); err != nil {
+			m.core.Logger.Errorf("Error reconnecting to %v: %v\n", self.Name, err)
+
+			self.mut.Lock()
+			if self.retrying || self.stopRetry != stop {
+				// Another supervisor took over or we were stopped
+				self.mut.Unlock()
+
+				return
+			}
+			self.retrying = true
+			self.mut.Unlock()
+
+			continue
+		}
+
+		return
+	}
+
+	m.core.Logger.Errorf("Giving up reconnecting to %v after %v attempts\n",
+		self.Name, b.Tries)
+	consLog.Println(styles.Red.Fg("Giving up reconnecting to %v", self.Name))
+
+	self.stopReconnect()
+}
+
+// Called once the server welcomes us; notifies modules with
+// Module.PostReconnect() if we were reconnecting
+func (self *Session) reconnected() {
+	m := self.manager
+
+	self.mut.Lock()
+	if !self.reconnecting {
+		self.mut.Unlock()
+
+		return
+	}
+
+	self.reconnecting = false
+	self.retrying = false
+	self.stopRetry = nil
+	self.mut.Unlock()
+
+	consLog.Println(styles.Green.Fg("Reconnected to %v", self.Name))
+	m.core.Logger.Infof("Reconnected to %v\n", self.Name)
+
+	for _, mod := range m.Modules() {
+		if err := mod.PostReconnect(self.Name); err != nil {
+			m.core.Logger.Errorf("%v.PostReconnect() error: %v\n", mod.Name(), err)
+		}
+	}
+}
+
+// Stops a pending reconnect
+func (self *Session) stopReconnect() {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	if self.stopRetry != nil {
+		close(self.stopRetry)
+		self.stopRetry = nil
+	}
+
+	self.reconnecting = false
+	self.retrying = false
+}
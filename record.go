@@ -0,0 +1,179 @@
+package irclib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Replaces secrets in recorded lines
+const Redacted = "<redacted>"
+
+// Record is a raw line sent or received on a network. Recordings are text
+// files with a Record per line:
+//
+//	2006-01-02T15:04:05.999999999Z07:00 network < :nick!ident@host PRIVMSG #bots :hi
+//	2006-01-02T15:04:05.999999999Z07:00 network > PRIVMSG #bots :hello
+type Record struct {
+	Time    time.Time
+	Network string
+	Sent    bool // Sent by the bot (">") rather than received ("<")
+	Line    string
+}
+
+func (self Record) String() string {
+	dir := "<"
+	if self.Sent {
+		dir = ">"
+	}
+
+	return fmt.Sprintf("%v %v %v %v", self.Time.Format(time.RFC3339Nano), self.Network, dir, self.Line)
+}
+
+// Parses a line of a recording
+func ParseRecord(s string) (Record, error) {
+	fields := strings.SplitN(s, " ", 4)
+	if len(fields) != 4 || (fields[2] != "<" && fields[2] != ">") {
+		return Record{}, fmt.Errorf("Malformed record %q", s)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return Record{}, fmt.Errorf("Malformed record time %q: %v", fields[0], err)
+	}
+
+	return Record{
+		Time:    t,
+		Network: fields[1],
+		Sent:    fields[2] == ">",
+		Line:    fields[3],
+	}, nil
+}
+
+// Returns the records read from `r`, skipping blank lines and # comments
+func ReadRecords(r io.Reader) ([]Record, error) {
+	records := make([]Record, 0, 100)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		record, err := ParseRecord(line)
+		if err != nil {
+			return nil, fmt.Errorf("Line %v: %v", n, err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// Returns the records in a recording file
+func ReadRecordFile(fileName string) ([]Record, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadRecords(f)
+}
+
+// Appends every raw line sent and received on every network to `fileName`.
+// Passwords and SASL payloads are replaced with Redacted
+func (self *ModManager) StartRecording(fileName string) error {
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	self.recMut.Lock()
+	defer self.recMut.Unlock()
+
+	if self.recorder != nil {
+		f.Close()
+
+		return errors.New("Already recording to " + self.recFile)
+	}
+
+	self.recorder, self.recFile = f, fileName
+
+	return nil
+}
+
+// Stops recording. Returns an error if not recording
+func (self *ModManager) StopRecording() error {
+	self.recMut.Lock()
+	defer self.recMut.Unlock()
+
+	if self.recorder == nil {
+		return errors.New("Not recording")
+	}
+
+	err := self.recorder.Close()
+	self.recorder, self.recFile = nil, ""
+
+	return err
+}
+
+// Returns the file being recorded to or an empty string
+func (self *ModManager) Recording() string {
+	self.recMut.Lock()
+	defer self.recMut.Unlock()
+
+	return self.recFile
+}
+
+func (self *ModManager) record(network, line string, sent bool) {
+	self.recMut.Lock()
+	defer self.recMut.Unlock()
+
+	if self.recorder == nil {
+		return
+	}
+
+	if sent {
+		line = redact(line)
+	}
+
+	record := Record{time.Now(), network, sent, line}
+	if _, err := fmt.Fprintln(self.recorder, record); err != nil {
+		self.core.Logger.Errorf("Stopped recording to %v: %v\n", self.recFile, err)
+
+		self.recorder.Close()
+		self.recorder, self.recFile = nil, ""
+	}
+}
+
+// Hides passwords in a line sent by the bot
+func redact(line string) string {
+	fields := strings.SplitN(line, " ", 3)
+
+	switch strings.ToUpper(fields[0]) {
+	case "PASS", "OPER":
+		return fields[0] + " " + Redacted
+	case "AUTHENTICATE":
+		if len(fields) > 1 && fields[1] != "+" && fields[1] != "*" &&
+			!strings.EqualFold(fields[1], "PLAIN") && !strings.EqualFold(fields[1], "EXTERNAL") {
+
+			return fields[0] + " " + Redacted
+		}
+	case "PRIVMSG":
+		if len(fields) == 3 && strings.EqualFold(fields[1], "NickServ") &&
+			strings.HasPrefix(strings.ToUpper(strings.TrimPrefix(fields[2], ":")), "IDENTIFY") {
+
+			return fields[0] + " " + fields[1] + " :IDENTIFY " + Redacted
+		}
+	}
+
+	return line
+}
@@ -0,0 +1,272 @@
+package irclib
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/crimsonvoid/console/styles"
+	"github.com/crimsonvoid/irclib/module"
+	irc "github.com/fluffle/goirc/client"
+)
+
+// Re-reads the config file the ModManager was created with and every module's
+// config file and applies what can change live: channels, access groups,
+// command prefix and reconnect settings, and each module's Enabled, allow/deny
+// lists and log directory. Only access groups and allow/deny lists edited in
+// the config files replace runtime changes; state files are not written.
+// Returns a line per change, including settings that only take effect after a
+// reconnect, and errors by module name, "core" for ours
+func (self *ModManager) Reload() ([]string, map[string]error) {
+	// The console and SIGHUP may reload at the same time
+	self.reloadMut.Lock()
+	defer self.reloadMut.Unlock()
+
+	report := make([]string, 0, 5)
+	errMap := make(map[string]error)
+
+	if self.configFile == "" {
+		if err := self.loadAccessState(); err != nil {
+			errMap["core"] = err
+		}
+	} else if changes, err := self.reloadServer(); err != nil {
+		errMap["core"] = err
+	} else {
+		report = append(report, changes...)
+	}
+
+	for _, mod := range self.Modules() {
+		changes, err := mod.Reload()
+		if err != nil {
+			errMap[mod.Name()] = err
+		}
+
+		for _, change := range changes {
+			report = append(report, fmt.Sprintf("%v: %v", mod.Name(), change))
+		}
+	}
+
+	return report, errMap
+}
+
+func (self *ModManager) reloadServer() ([]string, error) {
+	servInfo, err := readServerInfo(self.configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if servInfo.StateFile == "" {
+		servInfo.StateFile = module.StateFileFor(self.configFile)
+	}
+
+	report := make([]string, 0, 5)
+
+	if servInfo.Commands != nil && *servInfo.Commands != module.CmdPrefix() {
+		module.SetCmdPrefix(*servInfo.Commands)
+		report = append(report, "command prefix")
+	}
+
+	// Groups left as they were in the config keep their runtime changes
+	for _, grp := range self.Config.Access.reloadConfig(servInfo.Access) {
+		report = append(report, "access group "+grp)
+	}
+	self.Config.StateFile = servInfo.StateFile
+
+	seen := make(map[string]bool)
+	for i := range servInfo.Networks {
+		network := &servInfo.Networks[i]
+
+		s := self.Session(network.name())
+		if s == nil {
+			report = append(report, fmt.Sprintf("%v: new network needs a restart", network.name()))
+
+			continue
+		}
+
+		seen[s.Name] = true
+
+		changes, err := s.reload(servInfo, network)
+		if err != nil {
+			return report, fmt.Errorf("%v: %v", s.Name, err)
+		}
+
+		report = append(report, changes...)
+	}
+
+	for _, s := range self.sessions {
+		if !seen[s.Name] {
+			report = append(report, fmt.Sprintf("%v: removed network needs a restart", s.Name))
+		}
+	}
+
+	return report, nil
+}
+
+// Applies a reloaded network config: joins and parts channels and updates
+// reconnect and send queue settings. Other changes are reported as needing a reconnect
+func (self *Session) reload(serverInfo *ServerInfo, network *Network) ([]string, error) {
+	resolved := *network
+	resolved.Caps = serverInfo.caps(network)
+	network = &resolved
+
+	ircCfg, err := serverInfo.configServer(network)
+	if err != nil {
+		return nil, err
+	}
+
+	sasl, err := network.configSASL(ircCfg.Me.Nick)
+	if err != nil {
+		return nil, err
+	}
+
+	report := make([]string, 0, 5)
+	needs := self.reconnectNeeded(ircCfg, network)
+	if len(needs) != 0 {
+		report = append(report, fmt.Sprintf("%v: reconnect to apply %v", self.Name, needs))
+	}
+
+	want, have := serverInfo.channels(network), self.Chans()
+	for _, ch := range want {
+		if !inList(have, ch) {
+			self.Join(ch)
+			report = append(report, fmt.Sprintf("%v: joined %v", self.Name, ch))
+		}
+	}
+
+	for _, ch := range have {
+		if !inList(want, ch) {
+			self.Part(ch)
+			report = append(report, fmt.Sprintf("%v: parted %v", self.Name, ch))
+		}
+	}
+
+	self.mut.Lock()
+	old := self.network
+	if len(needs) == 0 {
+		self.network = *network
+		self.pending = nil
+	} else {
+		self.pending = &pending{network: *network, cfg: ircCfg, sasl: sasl}
+	}
+	self.reconnect = network.configBackoff()
+	self.network.Flood, self.network.SendBurst = network.Flood, network.SendBurst
+	self.network.SendRate, self.network.SendQueue = network.SendRate, network.SendQueue
+	self.mut.Unlock()
+
+	if old.Flood != network.Flood || old.SendBurst != network.SendBurst ||
+		old.SendRate != network.SendRate || old.SendQueue != network.SendQueue {
+
+		self.sendq.configure(network)
+		report = append(report, fmt.Sprintf("%v: send queue updated", self.Name))
+	}
+
+	return report, nil
+}
+
+// Config from a reload that can only be applied while disconnected
+type pending struct {
+	network Network
+	cfg     *irc.Config
+	sasl    SASL
+}
+
+// Swaps in config from a reload before dialing. Locked by callee
+func (self *Session) applyPending() {
+	if self.pending == nil {
+		return
+	}
+
+	self.wireConfig(self.pending.cfg)
+	*self.Conn.Config() = *self.pending.cfg
+	if self.pending.network.Tracking != self.network.Tracking {
+		self.setTracking(self.pending.network.Tracking)
+	}
+	self.network = self.pending.network
+	self.sasl = self.pending.sasl
+	self.pending = nil
+}
+
+// Returns the names of settings that differ from the running connection
+func (self *Session) reconnectNeeded(ircCfg *irc.Config, network *Network) []string {
+	old := self.Conn.Config()
+	needs := make([]string, 0, 5)
+
+	self.mut.RLock()
+	oldNet := self.network
+	self.mut.RUnlock()
+
+	changed := map[string]bool{
+		"server":      old.Server != ircCfg.Server,
+		"pass":        old.Pass != ircCfg.Pass,
+		"ssl":         oldNet.SSL != network.SSL || oldNet.TLS != network.TLS,
+		"sasl":        oldNet.SASL != network.SASL,
+		"nick":        old.Me.Nick != ircCfg.Me.Nick,
+		"ident":       old.Me.Ident != ircCfg.Me.Ident || old.Me.Name != ircCfg.Me.Name,
+		"pingfreq":    old.PingFreq != ircCfg.PingFreq,
+		"splitlen":    old.SplitLen != ircCfg.SplitLen,
+		"tracking":    oldNet.Tracking != network.Tracking,
+		"caps":        strings.Join(oldNet.Caps, " ") != strings.Join(network.Caps, " "),
+		"version":     old.Version != ircCfg.Version,
+		"quitmessage": old.QuitMessage != ircCfg.QuitMessage,
+	}
+
+	for _, name := range []string{"server", "pass", "ssl", "sasl", "nick", "ident",
+		"pingfreq", "splitlen", "tracking", "caps", "version", "quitmessage"} {
+
+		if changed[name] {
+			needs = append(needs, name)
+		}
+	}
+
+	return needs
+}
+
+// Reloads and prints what changed; used by the console and SIGHUP
+func (self *ModManager) coreReload() {
+	report, errMap := self.Reload()
+
+	for _, line := range report {
+		consLog.Println(line)
+		self.core.Logger.Infoln("Reload", line)
+	}
+
+	if len(errMap) == 0 {
+		consLog.Println(styles.Green.Fg("Reloaded without errors"))
+		self.core.Logger.Infoln("Reloaded without errors")
+
+		return
+	}
+
+	out := styles.Red.Fg("Errors when attempting to reload\n")
+	for modName, err := range errMap {
+		out += fmt.Sprintf("  %v: %v\n", modName, err)
+		self.core.Logger.Errorf("Reload %v: %v\n", modName, err)
+	}
+	consLog.Print(out)
+}
+
+// Reloads on SIGHUP until ModManager.stopSignals() is called. Locked by callee
+func (self *ModManager) watchSignals() {
+	self.sighup = make(chan os.Signal, 1)
+	signal.Notify(self.sighup, syscall.SIGHUP)
+
+	go func(sighup chan os.Signal) {
+		for range sighup {
+			self.core.Logger.Infoln("Received SIGHUP, reloading")
+			self.coreReload()
+		}
+	}(self.sighup)
+}
+
+// Stops reloading on SIGHUP. Locked by callee
+func (self *ModManager) stopSignals() {
+	if self.sighup == nil {
+		return
+	}
+
+	signal.Stop(self.sighup)
+	close(self.sighup)
+	self.sighup = nil
+}
@@ -0,0 +1,185 @@
+package irclib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/crimsonvoid/irclib/module"
+)
+
+// Unregisters a module, calling Exit() first if it is running. It stops
+// receiving events and console commands and is kept so Load() can register it
+// again. Returns an error if it is not registered, another module requires it,
+// or Exit() failed, in which case it stays registered
+func (self *ModManager) Unregister(name string) error {
+	self.mut.Lock()
+	_, mod := self.find(name)
+	if mod == nil {
+		self.mut.Unlock()
+
+		return fmt.Errorf("Module %v is not registered", name)
+	}
+
+	for _, other := range self.modules {
+		if inList(other.Requires(), name) {
+			self.mut.Unlock()
+
+			return fmt.Errorf("Module %v is required by %v", name, other.Name())
+		}
+	}
+	self.mut.Unlock()
+
+	// Not locked so Exit() may call the ModManager
+	if mod.Running() {
+		if err := mod.Exit(); err != nil {
+			return err
+		}
+	}
+
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	for i, m := range self.modules {
+		if m == mod {
+			self.unload(i)
+			break
+		}
+	}
+
+	return nil
+}
+
+// Registers a module removed by Unregister() or ForceDisconnectModule() again,
+// starting it if the ModManager is running
+func (self *ModManager) Load(name string) error {
+	self.mut.Lock()
+	var mod *module.Module
+	for i, m := range self.unloaded {
+		if strings.EqualFold(m.Name(), name) {
+			mod = m
+			self.unloaded = append(self.unloaded[:i], self.unloaded[i+1:]...)
+			break
+		}
+	}
+	self.mut.Unlock()
+
+	if mod == nil {
+		return fmt.Errorf("Module %v is not unloaded", name)
+	}
+
+	if err := self.Register(mod); err != nil {
+		self.mut.Lock()
+		self.unloaded = append(self.unloaded, mod)
+		self.mut.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+// Calls Exit() then PreStart() and Start() on a running module. Modules that
+// require it keep running
+func (self *ModManager) Restart(name string) error {
+	self.mut.RLock()
+	running := self.running
+	_, mod := self.find(name)
+	self.mut.RUnlock()
+
+	if !running {
+		return errors.New("ModManager is not running")
+	}
+
+	if mod == nil {
+		return fmt.Errorf("Module %v is not registered", name)
+	}
+
+	if mod.Running() {
+		if err := mod.Exit(); err != nil {
+			return err
+		}
+	}
+
+	return self.startModule(mod)
+}
+
+// Returns the names of modules that were unloaded
+func (self *ModManager) Unloaded() []string {
+	self.mut.RLock()
+	defer self.mut.RUnlock()
+
+	names := make([]string, len(self.unloaded))
+	for i, mod := range self.unloaded {
+		names[i] = mod.Name()
+	}
+
+	return names
+}
+
+// Calls PreStart() and Start() on a module registered while running. Modules
+// it requires must be running. The ModManager must not be locked, hooks may
+// call it
+func (self *ModManager) startModule(mod *module.Module) error {
+	self.mut.RLock()
+	for _, dep := range mod.Requires() {
+		if _, m := self.find(dep); m == nil || !m.Running() {
+			self.mut.RUnlock()
+
+			return fmt.Errorf("Module %v requires %v which is not running", mod.Name(), dep)
+		}
+	}
+	self.mut.RUnlock()
+
+	if err := mod.PreStart(); err != nil {
+		self.core.Logger.Errorf("%v.PreStart() error: %v\n", mod.Name(), err)
+
+		return err
+	}
+
+	if err := mod.Start(); err != nil {
+		self.core.Logger.Errorf("%v.Start() error: %v\n", mod.Name(), err)
+
+		return err
+	}
+
+	mod.Logger.Infof("%v.Start() successful!\n", mod.Name())
+
+	self.mut.Lock()
+	for _, s := range self.sessions {
+		self.syncEvents(s)
+	}
+	self.mut.Unlock()
+
+	return nil
+}
+
+// Returns the index and registered module named `name`, ignoring case, or
+// nil. Locked by callee
+func (self *ModManager) find(name string) (int, *module.Module) {
+	for i, mod := range self.modules {
+		if strings.EqualFold(mod.Name(), name) {
+			return i, mod
+		}
+	}
+
+	return -1, nil
+}
+
+// Moves module `i` to the unloaded list and drops handlers for events no
+// other module needs. Locked by callee
+func (self *ModManager) unload(i int) {
+	mod := self.modules[i]
+	self.modules = append(self.modules[:i], self.modules[i+1:]...)
+
+	mod.Conn, mod.Client = nil, nil
+	self.unloaded = append(self.unloaded, mod)
+
+	if self.running {
+		for _, s := range self.sessions {
+			self.syncEvents(s)
+		}
+	}
+
+	self.core.Logger.Infof("Unloaded %v\n", mod.Name())
+}
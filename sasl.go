@@ -0,0 +1,81 @@
+package irclib
+
+import (
+	"encoding/base64"
+
+	irc "github.com/fluffle/goirc/client"
+)
+
+// Largest AUTHENTICATE payload chunk allowed by the SASL spec
+const saslChunk = 400
+
+// Registers handlers to authenticate with SASL once the capability is
+// acknowledged. Channels are not joined on CONNECTED until authentication
+// succeeded (903) or failed (904) as CAP END is only sent then
+func (self *Session) setupSASL() {
+	if self.sasl.Mechanism == "" {
+		return
+	}
+
+	self.Conn.HandleFunc("AUTHENTICATE", func(con *irc.Conn, line *irc.Line) {
+		if len(line.Args) == 0 || line.Args[0] != "+" {
+			return
+		}
+
+		if self.sasl.Mechanism == "EXTERNAL" {
+			// Identity comes from the client certificate
+			con.Raw("AUTHENTICATE +")
+
+			return
+		}
+
+		payload := self.sasl.User + "\x00" + self.sasl.User + "\x00" + self.sasl.Pass
+		encoded := base64.StdEncoding.EncodeToString([]byte(payload))
+
+		for len(encoded) >= saslChunk {
+			con.Raw("AUTHENTICATE " + encoded[:saslChunk])
+			encoded = encoded[saslChunk:]
+		}
+
+		// A payload that is a multiple of saslChunk is terminated by "+"
+		if encoded == "" {
+			encoded = "+"
+		}
+		con.Raw("AUTHENTICATE " + encoded)
+	})
+
+	// RPL_SASLSUCCESS, ERR_SASLALREADY
+	for _, numeric := range []string{"903", "907"} {
+		self.Conn.HandleFunc(numeric, func(con *irc.Conn, line *irc.Line) {
+			self.mut.Lock()
+			self.authed = true
+			self.mut.Unlock()
+
+			self.manager.core.Logger.Infof("Authenticated to %v as %v\n",
+				self.Name, self.sasl.User)
+			con.Raw("CAP END")
+		})
+	}
+
+	// ERR_NICKLOCKED, ERR_SASLFAIL, ERR_SASLTOOLONG, ERR_SASLABORTED
+	for _, numeric := range []string{"902", "904", "905", "906"} {
+		self.Conn.HandleFunc(numeric, func(con *irc.Conn, line *irc.Line) {
+			self.manager.core.Logger.Errorf("SASL %v failed on %v: %v\n",
+				self.sasl.Mechanism, self.Name, line.Text())
+			con.Raw("CAP END")
+		})
+	}
+}
+
+// Identifies to NickServ if configured to and SASL did not authenticate
+func (self *Session) identify() {
+	self.mut.RLock()
+	authed := self.authed
+	self.mut.RUnlock()
+
+	if authed || !self.sasl.NickServ {
+		return
+	}
+
+	self.Conn.Privmsg("NickServ", "IDENTIFY "+self.sasl.User+" "+self.sasl.Pass)
+}
@@ -0,0 +1,502 @@
+package irclib
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crimsonvoid/irclib/module"
+)
+
+// Lines sent through a Session's module.Client wait in its send queue. A single
+// goroutine sends them, highest priority first, as a token bucket of bytes
+// allows. Lines of one priority take turns by target so a module flooding one
+// channel does not hold up replies elsewhere. Lines written any other way, such
+// as by the library, goirc or Module.Conn, skip the queue but the wire still
+// takes their tokens and waits for them like goirc's own flood control did
+
+const (
+	defaultSendBurst = 1024 // Bytes sent at once before throttling
+	defaultSendRate  = 128  // Bytes per second the bucket refills
+	defaultSendQueue = 512  // Lines queued before new ones are dropped
+
+	// Added to the length of every line so short lines are throttled too
+	sendLineCost = 64
+)
+
+// SendStats is a snapshot of a network's send queue
+type SendStats struct {
+	Depth    int           // Lines queued
+	High     int           // Lines queued at module.PriorityHigh
+	Normal   int           // Lines queued at module.PriorityNormal
+	Low      int           // Lines queued at module.PriorityLow
+	Targets  int           // Targets with lines queued
+	MaxDepth int           // Most lines queued at once
+	Oldest   time.Duration // Time the oldest queued line has waited
+	Tokens   int           // Bytes that can be sent without waiting
+	Sent     uint64
+	Dropped  uint64 // Lines dropped because the queue was full or disconnected
+}
+
+type sendItem struct {
+	target string // Lowered; lines for one target are sent in order
+	cost   int    // Bytes taken from the bucket
+	queued time.Time
+	send   func()
+}
+
+// Lines of one priority by target. Targets in order take turns
+type sendClass struct {
+	lines map[string][]*sendItem
+	order []string
+}
+
+type sendQueue struct {
+	classes [module.PriorityLow + 1]sendClass
+	depth   int
+
+	throttle bool    // False with Network.Flood; lines are sent at once
+	burst    float64 // Bytes the bucket holds
+	rate     float64 // Bytes per second the bucket refills
+	limit    int     // Lines queued before new ones are dropped
+	tokens   float64
+	refilled time.Time
+	prepaid  int // Bytes the queue paid for that the wire has not written yet
+
+	draining bool // drain() is running
+	maxDepth int
+	sent     uint64
+	dropped  uint64
+
+	mut sync.Mutex
+}
+
+func newSendQueue(network *Network) *sendQueue {
+	q := new(sendQueue)
+	for i := range q.classes {
+		q.classes[i].lines = make(map[string][]*sendItem)
+	}
+
+	q.configure(network)
+	q.tokens = q.burst
+
+	return q
+}
+
+// Applies the send settings of `network`; used on creation and reload
+func (self *sendQueue) configure(network *Network) {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	self.throttle = !network.Flood
+	self.burst = float64(defaultSendBurst)
+	if network.SendBurst > 0 {
+		self.burst = float64(network.SendBurst)
+	}
+	self.rate = float64(defaultSendRate)
+	if network.SendRate > 0 {
+		self.rate = float64(network.SendRate)
+	}
+	self.limit = defaultSendQueue
+	if network.SendQueue > 0 {
+		self.limit = network.SendQueue
+	}
+
+	if self.tokens > self.burst {
+		self.tokens = self.burst
+	}
+}
+
+// Queues `send`, which sends `line` to `target`. Returns false if the queue is
+// full and the line was dropped
+func (self *sendQueue) push(priority module.Priority, target, line string, send func()) bool {
+	if priority < module.PriorityHigh {
+		priority = module.PriorityHigh
+	} else if priority > module.PriorityLow {
+		priority = module.PriorityLow
+	}
+
+	target = strings.ToLower(target)
+	item := &sendItem{target: target, cost: len(line) + 2 + sendLineCost, queued: time.Now(), send: send}
+
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	if self.depth >= self.limit {
+		self.dropped++
+
+		return false
+	}
+
+	class := &self.classes[priority]
+	if len(class.lines[target]) == 0 {
+		class.order = append(class.order, target)
+	}
+	class.lines[target] = append(class.lines[target], item)
+
+	if self.depth++; self.depth > self.maxDepth {
+		self.maxDepth = self.depth
+	}
+
+	if !self.draining {
+		self.draining = true
+		go self.drain()
+	}
+
+	return true
+}
+
+// Returns the next line to send and removes it if `remove`, or nil if the
+// queue is empty. Locked by callee
+func (self *sendQueue) next(remove bool) *sendItem {
+	for i := range self.classes {
+		class := &self.classes[i]
+		if len(class.order) == 0 {
+			continue
+		}
+
+		target := class.order[0]
+		lines := class.lines[target]
+		item := lines[0]
+		if !remove {
+			return item
+		}
+
+		// The target goes to the back of the line if it has more to send
+		class.order = class.order[1:]
+		if len(lines) == 1 {
+			delete(class.lines, target)
+		} else {
+			class.lines[target] = lines[1:]
+			class.order = append(class.order, target)
+		}
+		self.depth--
+
+		return item
+	}
+
+	return nil
+}
+
+// Adds tokens for the time since the last refill. Locked by callee
+func (self *sendQueue) refill() {
+	now := time.Now()
+	if !self.refilled.IsZero() {
+		self.tokens += now.Sub(self.refilled).Seconds() * self.rate
+		if self.tokens > self.burst {
+			self.tokens = self.burst
+		}
+	}
+
+	self.refilled = now
+}
+
+// Sends queued lines until the queue is empty. The next line is chosen again
+// after waiting for tokens so a higher priority line queued meanwhile goes
+// first
+func (self *sendQueue) drain() {
+	for {
+		self.mut.Lock()
+
+		item := self.next(false)
+		if item == nil {
+			self.draining = false
+			self.mut.Unlock()
+
+			return
+		}
+
+		self.refill()
+
+		// A line longer than the bucket is sent once it is full
+		cost := float64(item.cost)
+		if cost > self.burst {
+			cost = self.burst
+		}
+
+		if self.throttle && self.tokens < cost {
+			wait := time.Duration((cost - self.tokens) / self.rate * float64(time.Second))
+			self.mut.Unlock()
+			time.Sleep(wait)
+
+			continue
+		}
+
+		self.next(true)
+		if self.throttle {
+			self.tokens -= float64(item.cost)
+			self.prepaid += item.cost
+		}
+		self.sent++
+		self.mut.Unlock()
+
+		item.send()
+	}
+}
+
+// Called by the wire before writing `p`. Bytes the queue paid for pass; the
+// rest wait for tokens
+func (self *sendQueue) write(p []byte) {
+	cost := len(p) + bytes.Count(p, []byte("\n"))*sendLineCost
+
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	if !self.throttle {
+		return
+	}
+
+	paid := self.prepaid
+	if paid > cost {
+		paid = cost
+	}
+	self.prepaid -= paid
+	if cost -= paid; cost == 0 {
+		return
+	}
+
+	for {
+		self.refill()
+
+		need := float64(cost)
+		if need > self.burst {
+			need = self.burst
+		}
+
+		if self.tokens >= need || !self.throttle {
+			break
+		}
+
+		wait := time.Duration((need - self.tokens) / self.rate * float64(time.Second))
+		self.mut.Unlock()
+		time.Sleep(wait)
+		self.mut.Lock()
+	}
+
+	self.tokens -= float64(cost)
+}
+
+// Drops every queued line, such as after disconnecting
+func (self *sendQueue) clear() {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	for i := range self.classes {
+		self.classes[i] = sendClass{lines: make(map[string][]*sendItem)}
+	}
+
+	self.dropped += uint64(self.depth)
+	self.depth = 0
+	self.prepaid = 0
+}
+
+func (self *sendQueue) stats() SendStats {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	self.refill()
+
+	stats := SendStats{
+		Depth:    self.depth,
+		MaxDepth: self.maxDepth,
+		Tokens:   int(self.tokens),
+		Sent:     self.sent,
+		Dropped:  self.dropped,
+	}
+
+	var oldest time.Time
+	for i := range self.classes {
+		class := &self.classes[i]
+		stats.Targets += len(class.order)
+
+		queued := 0
+		for _, lines := range class.lines {
+			queued += len(lines)
+			if oldest.IsZero() || lines[0].queued.Before(oldest) {
+				oldest = lines[0].queued
+			}
+		}
+
+		switch module.Priority(i) {
+		case module.PriorityHigh:
+			stats.High = queued
+		case module.PriorityNormal:
+			stats.Normal = queued
+		case module.PriorityLow:
+			stats.Low = queued
+		}
+	}
+
+	if !oldest.IsZero() {
+		stats.Oldest = time.Since(oldest)
+	}
+
+	return stats
+}
+
+// Returns a snapshot of the send queue
+func (self *Session) SendStats() SendStats {
+	return self.sendq.stats()
+}
+
+// Returns a snapshot of the send queue of every network by name
+func (self *ModManager) SendStats() map[string]SendStats {
+	stats := make(map[string]SendStats)
+	for _, s := range self.Sessions() {
+		stats[s.Name] = s.SendStats()
+	}
+
+	return stats
+}
+
+// Returns a Client whose lines are queued at `priority`
+func (self *Session) WithPriority(priority module.Priority) module.Client {
+	return &prioritized{self, priority}
+}
+
+// Returns the Session's Client at `priority`
+func (self *Session) at(priority module.Priority) *prioritized {
+	return &prioritized{self, priority}
+}
+
+// Client that queues lines at a priority. Everything other than sending is
+// the Session's
+type prioritized struct {
+	*Session
+
+	priority module.Priority
+}
+
+// Queues `send`, which sends `line` to `target`. Lines are dropped while
+// disconnected
+func (self *prioritized) enqueue(target, line string, send func()) {
+	if !self.Connected() {
+		return
+	}
+
+	self.sendq.push(self.priority, target, line, send)
+}
+
+func (self *prioritized) WithPriority(priority module.Priority) module.Client {
+	return &prioritized{self.Session, priority}
+}
+
+// Queues a raw line. PONG is always sent at module.PriorityHigh
+func (self *prioritized) Raw(line string) {
+	words := strings.Fields(line)
+	if len(words) != 0 && strings.HasPrefix(words[0], "@") {
+		words = words[1:]
+	}
+
+	target := ""
+	if len(words) > 1 {
+		target = words[1]
+	}
+
+	client := self
+	if len(words) != 0 && strings.EqualFold(words[0], "PONG") {
+		client = self.at(module.PriorityHigh)
+	}
+
+	client.enqueue(target, line, func() {
+		self.Conn.Raw(line)
+	})
+}
+
+func (self *prioritized) Privmsg(target, msg string) {
+	self.enqueue(target, "PRIVMSG "+target+" :"+msg, func() {
+		self.Conn.Privmsg(target, msg)
+	})
+}
+
+func (self *prioritized) Notice(target, msg string) {
+	self.enqueue(target, "NOTICE "+target+" :"+msg, func() {
+		self.Conn.Notice(target, msg)
+	})
+}
+
+func (self *prioritized) Action(target, msg string) {
+	self.enqueue(target, "PRIVMSG "+target+" :\x01ACTION "+msg+"\x01", func() {
+		self.Conn.Action(target, msg)
+	})
+}
+
+// Join a channel and rejoin it after reconnecting
+func (self *prioritized) Join(channel string, key ...string) {
+	self.mut.Lock()
+	if !inList(self.chans, channel) {
+		self.chans = append(self.chans, strings.ToLower(channel))
+	}
+	self.mut.Unlock()
+
+	self.enqueue(channel, "JOIN "+channel+" "+strings.Join(key, " "), func() {
+		self.Conn.Join(channel, key...)
+	})
+}
+
+// Part a channel and do not rejoin it after reconnecting
+func (self *prioritized) Part(channel string, message ...string) {
+	self.mut.Lock()
+	remove(&self.chans, channel)
+	self.mut.Unlock()
+
+	self.enqueue(channel, "PART "+channel+" :"+strings.Join(message, " "), func() {
+		self.Conn.Part(channel, message...)
+	})
+}
+
+func (self *prioritized) Kick(channel, nick string, message ...string) {
+	self.enqueue(channel, "KICK "+channel+" "+nick+" :"+strings.Join(message, " "), func() {
+		self.Conn.Kick(channel, nick, message...)
+	})
+}
+
+func (self *prioritized) Topic(channel string, topic ...string) {
+	self.enqueue(channel, "TOPIC "+channel+" :"+strings.Join(topic, " "), func() {
+		self.Conn.Topic(channel, topic...)
+	})
+}
+
+// Queues a PRIVMSG with client-only tags such as "+draft/reply". Tags are
+// dropped if the server does not support message-tags
+func (self *prioritized) PrivmsgTags(target, msg string, tags map[string]string) {
+	tagged := self.clientTags(tags)
+	if len(tagged) == 0 {
+		self.Privmsg(target, msg)
+
+		return
+	}
+
+	for _, text := range splitText(msg, self.Conn.Config().SplitLen) {
+		self.Raw(formatTags(tagged) + "PRIVMSG " + target + " :" + text)
+	}
+}
+
+// Queues a NOTICE with client-only tags. Tags are dropped if the server does
+// not support message-tags
+func (self *prioritized) NoticeTags(target, msg string, tags map[string]string) {
+	tagged := self.clientTags(tags)
+	if len(tagged) == 0 {
+		self.Notice(target, msg)
+
+		return
+	}
+
+	for _, text := range splitText(msg, self.Conn.Config().SplitLen) {
+		self.Raw(formatTags(tagged) + "NOTICE " + target + " :" + text)
+	}
+}
+
+// Queues a TAGMSG, a message with only client-only tags such as reactions.
+// Returns false without sending if the server does not support message-tags
+func (self *prioritized) TagMsg(target string, tags map[string]string) bool {
+	tagged := self.clientTags(tags)
+	if len(tagged) == 0 {
+		return false
+	}
+
+	self.Raw(formatTags(tagged) + "TAGMSG " + target)
+
+	return true
+}
@@ -3,24 +3,63 @@ package irclib
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/crimsonvoid/irclib/module"
 	irc "github.com/fluffle/goirc/client"
 )
 
 type BotInfo struct {
-	Chans  []string
-	Access access
+	Access    *access
+	StateFile string // File runtime access changes are saved to
+	Record    string // File raw lines are recorded to while connected
 }
 
 type Network struct {
+	Name     string   // Unique name events are tagged with, defaults to Server
+	Nick     string   // Overrides ServerInfo.Nick on this network
+	Pass     string   // Overrides ServerInfo.Pass on this network
+	Channels []string // Overrides ServerInfo.Channels on this network
+
 	SSL      bool
 	Server   string
 	Port     int
 	PingFreq int
 	SplitLen int
-	Flood    bool
 	Tracking bool
+	Caps     []string // Overrides ServerInfo.Caps on this network
+
+	// Lines sent by modules are queued and sent as a token bucket allows:
+	// SendBurst bytes at once, refilled at SendRate bytes per second. Each
+	// line costs its length plus 64 bytes. SendQueue lines are queued before
+	// new ones are dropped. Lines written past the queue, such as with
+	// Module.Conn, take tokens too. Flood turns flood control off
+	Flood     bool
+	SendBurst int
+	SendRate  int
+	SendQueue int
+
+	// Reconnect after the connection drops. The delay before each attempt
+	// doubles from ReconnectDelay up to ReconnectMax seconds and is spread
+	// by up to ReconnectJitter (0.0 - 1.0) of itself. ReconnectTries limits
+	// the number of attempts, 0 retries forever
+	Reconnect       bool
+	ReconnectDelay  int
+	ReconnectMax    int
+	ReconnectJitter float64
+	ReconnectTries  int
+
+	TLS  TLS
+	SASL SASL
+}
+
+// SASL authentication settings for a network
+type SASL struct {
+	Mechanism string // "plain", "external" or empty to disable SASL
+	User      string // Account name, defaults to the nick
+	Pass      string // Account password; unused by EXTERNAL
+	NickServ  bool   // Identify to NickServ when SASL is disabled or fails
 }
 
 type Groups struct {
@@ -33,35 +72,63 @@ type ServerInfo struct {
 	Channels          []string
 	Version           string
 	QuitMessage       string
+	StateFile         string // File runtime access changes are saved to
+	Record            string // Record raw lines to this file for irctest.Replay
+	Modules           string // Directory of subprocess modules registered on start
 
-	Network Network
-	Access  map[string]Groups
+	// IRCv3 capabilities requested when the server offers them; defaults to
+	// account-notify, account-tag, away-notify, batch, chghost, extended-join,
+	// message-tags, multi-prefix, server-time and draft/chathistory.
+	// echo-message is only requested when listed; echoed lines reach E_RAW
+	// handlers only. labeled-response is not supported
+	Caps []string
+
+	// How IRC commands are recognised; defaults to "!", highlights and
+	// private messages
+	Commands *module.CommandPrefix
+
+	Networks []Network `toml:"network"`
+	Access   map[string]Groups
 }
 
-func (serverInfo *ServerInfo) configServer() (*irc.Config, error) {
+func (serverInfo *ServerInfo) configServer(network *Network) (*irc.Config, error) {
+	nick := network.Nick
+	if nick == "" {
+		nick = serverInfo.Nick
+	}
+
 	// Check there is enough info to set up a server
 	switch {
-	case serverInfo.Nick == "":
+	case nick == "":
 		return nil, errors.New("Specify a Nick in the config file")
-	case serverInfo.Network.Server == "":
+	case network.Server == "":
 		return nil, errors.New("Specify a Server in the config file")
 	}
 
-	if serverInfo.Ident == "" {
-		serverInfo.Ident = serverInfo.Nick
+	ident, name := serverInfo.Ident, serverInfo.Name
+	if ident == "" {
+		ident = nick
 	}
-	if serverInfo.Name == "" {
-		serverInfo.Name = serverInfo.Nick
+	if name == "" {
+		name = nick
 	}
 
-	cfg := irc.NewConfig(serverInfo.Nick, serverInfo.Ident, serverInfo.Name)
+	cfg := irc.NewConfig(nick, ident, name)
 
 	cfg.Pass = serverInfo.Pass
-	// if serverInfo.SSL is true, user will have to configure it themself
-	cfg.SSL = serverInfo.Network.SSL
-	cfg.Server = fmt.Sprintf("%v:%v",
-		serverInfo.Network.Server,
-		serverInfo.Network.Port)
+	if network.Pass != "" {
+		cfg.Pass = network.Pass
+	}
+	cfg.SSL = network.SSL
+	if cfg.SSL {
+		sslCfg, err := network.configTLS()
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.SSLConfig = sslCfg
+	}
+	cfg.Server = fmt.Sprintf("%v:%v", network.Server, network.Port)
 
 	if serverInfo.Version != "" {
 		cfg.Version = serverInfo.Version
@@ -69,14 +136,113 @@ func (serverInfo *ServerInfo) configServer() (*irc.Config, error) {
 	if serverInfo.QuitMessage != "" {
 		cfg.QuitMessage = serverInfo.QuitMessage
 	}
-	if serverInfo.Network.PingFreq > 0 {
-		cfg.PingFreq = time.Duration(serverInfo.Network.PingFreq) * time.Second
+	if network.PingFreq > 0 {
+		cfg.PingFreq = time.Duration(network.PingFreq) * time.Second
 	}
-	if serverInfo.Network.SplitLen > 0 {
-		cfg.SplitLen = serverInfo.Network.SplitLen
+	if network.SplitLen > 0 {
+		cfg.SplitLen = network.SplitLen
 	}
-	// Default value of bool is false which is default for cfg.Flood
-	cfg.Flood = serverInfo.Network.Flood
+	// The wire throttles every line with the send queue's token bucket
+	// instead of goirc; see sendq.go
+	cfg.Flood = true
 
 	return cfg, nil
 }
+
+func (network *Network) configSASL(nick string) (SASL, error) {
+	sasl := network.SASL
+	sasl.Mechanism = strings.ToUpper(sasl.Mechanism)
+
+	if sasl.User == "" {
+		sasl.User = nick
+	}
+
+	switch sasl.Mechanism {
+	case "":
+	case "EXTERNAL":
+		if !network.SSL || network.TLS.Cert == "" {
+			return sasl, errors.New("SASL EXTERNAL needs ssl and a TLS Cert in the config file")
+		}
+	case "PLAIN":
+		if sasl.Pass == "" {
+			return sasl, errors.New("Specify a SASL Pass in the config file")
+		}
+	default:
+		return sasl, fmt.Errorf("Unsupported SASL mechanism %v", sasl.Mechanism)
+	}
+
+	if sasl.NickServ && sasl.Pass == "" {
+		return sasl, errors.New("Specify a SASL Pass in the config file to identify to NickServ")
+	}
+
+	return sasl, nil
+}
+
+// Returns the lowered network name, which defaults to the server
+func (network *Network) name() string {
+	if network.Name == "" {
+		return strings.ToLower(network.Server)
+	}
+
+	return strings.ToLower(network.Name)
+}
+
+// Returns a lowered copy of the channels to join on `network`
+func (serverInfo *ServerInfo) channels(network *Network) []string {
+	// copy Chans to allow serverInfo to be marked for GC
+	chanList := serverInfo.Channels
+	if len(network.Channels) != 0 {
+		chanList = network.Channels
+	}
+
+	chans := make([]string, len(chanList))
+	for i, ch := range chanList {
+		chans[i] = strings.ToLower(ch)
+	}
+
+	return chans
+}
+
+// Returns the lowered capabilities to request on `network`
+func (serverInfo *ServerInfo) caps(network *Network) []string {
+	capList := defaultCaps
+	if len(network.Caps) != 0 {
+		capList = network.Caps
+	} else if len(serverInfo.Caps) != 0 {
+		capList = serverInfo.Caps
+	}
+
+	caps := make([]string, len(capList))
+	for i, c := range capList {
+		caps[i] = strings.ToLower(c)
+	}
+
+	return caps
+}
+
+func (network *Network) configBackoff() backoff {
+	b := backoff{
+		Enabled: network.Reconnect,
+		Delay:   time.Duration(network.ReconnectDelay) * time.Second,
+		Max:     time.Duration(network.ReconnectMax) * time.Second,
+		Jitter:  network.ReconnectJitter,
+		Tries:   network.ReconnectTries,
+	}
+
+	if b.Delay <= 0 {
+		b.Delay = 5 * time.Second
+	}
+	if b.Max <= 0 {
+		b.Max = 5 * time.Minute
+	}
+	if b.Max < b.Delay {
+		b.Max = b.Delay
+	}
+	if b.Jitter < 0 {
+		b.Jitter = 0
+	} else if b.Jitter > 1 {
+		b.Jitter = 1
+	}
+
+	return b
+}
@@ -0,0 +1,165 @@
+package irclib
+
+import (
+	"crypto/tls"
+	"sync"
+
+	"github.com/crimsonvoid/irclib/module"
+	irc "github.com/fluffle/goirc/client"
+)
+
+// Session is the connection to a single network. It implements module.Client
+// so handlers can reply on the network a line arrived on
+type Session struct {
+	Name string    // Network name events are tagged with
+	Conn *irc.Conn // IRC Connection
+
+	chans   []string // Channels to join on connect
+	network Network  // Config the session was created with
+
+	sasl   SASL     // SASL settings
+	authed bool     // SASL authentication succeeded
+	capLS  []string // Capabilities advertised so far by CAP LS
+	caps   []string // Capabilities acknowledged by the server
+
+	welcomed bool // RPL_WELCOME received since registering
+
+	accounts map[string]string          // Lowered nick to services account
+	common   map[string]map[string]bool // Lowered nick to channels shared with the bot
+	away     map[string]string          // Lowered nick to away message of away users
+	whox     bool                       // Server supports WHOX
+
+	modeTypes module.ModeTypes // From CHANMODES and PREFIX in RPL_ISUPPORT
+
+	reconnect    backoff
+	reconnecting bool      // Connection was lost and we were not welcomed again
+	retrying     bool      // Reconnect supervisor is waiting to dial
+	stopRetry    chan bool // Closed to stop the reconnect supervisor
+	pending      *pending  // Reloaded config applied on the next reconnect
+
+	events     map[string]irc.Remover // Handlers dispatching events to modules
+	wireEvents map[module.Event]bool  // E_ANY and E_RAW if a module wants them
+
+	queries  []*query // Queries sent, oldest first
+	waiting  []*query // Our queries not yet seen on the wire
+	queryMut sync.Mutex
+
+	batches  map[string]*openBatch // Batches seen on the wire, by reference
+	history  []*historyWait        // ChatHistory() calls, oldest first
+	batchMut sync.Mutex
+
+	sendq *sendQueue // Lines sent by modules
+
+	wireID    string      // Name of the session's wire dialer
+	tlsConfig *tls.Config // TLS done by the wire, nil without SSL
+
+	manager *ModManager
+	mut     sync.RWMutex
+}
+
+func newSession(manager *ModManager, serverInfo *ServerInfo, network *Network) (*Session, error) {
+	ircCfg, err := serverInfo.configServer(network)
+	if err != nil {
+		return nil, err
+	}
+
+	sasl, err := network.configSASL(ircCfg.Me.Nick)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		Name:      network.name(),
+		chans:     serverInfo.channels(network),
+		network:   *network,
+		sasl:      sasl,
+		accounts:  make(map[string]string),
+		common:    make(map[string]map[string]bool),
+		away:      make(map[string]string),
+		modeTypes: module.DefaultModeTypes,
+		events:    make(map[string]irc.Remover),
+		batches:   make(map[string]*openBatch),
+		sendq:     newSendQueue(network),
+		reconnect: network.configBackoff(),
+		manager:   manager,
+	}
+	s.network.Caps = serverInfo.caps(network)
+
+	s.wireConfig(ircCfg)
+	s.Conn = irc.Client(ircCfg)
+
+	if network.Tracking {
+		s.setTracking(true)
+	}
+
+	return s, nil
+}
+
+// Returns a copy of the channels joined on connect
+func (self *Session) Chans() []string {
+	self.mut.RLock()
+	defer self.mut.RUnlock()
+
+	chans := make([]string, len(self.chans))
+	copy(chans, self.chans)
+
+	return chans
+}
+
+// Name of the network
+func (self *Session) Network() string {
+	return self.Name
+}
+
+// Current nick on the network
+func (self *Session) Nick() string {
+	return self.Conn.Me().Nick
+}
+
+func (self *Session) Connected() bool {
+	return self.Conn.Connected()
+}
+
+// Channel modes the server advertised, or module.DefaultModeTypes
+func (self *Session) ModeTypes() module.ModeTypes {
+	self.mut.RLock()
+	defer self.mut.RUnlock()
+
+	return self.modeTypes
+}
+
+// Lines are sent through the send queue at module.PriorityNormal; see sendq.go
+
+func (self *Session) Raw(line string) {
+	self.at(module.PriorityNormal).Raw(line)
+}
+
+func (self *Session) Privmsg(target, msg string) {
+	self.at(module.PriorityNormal).Privmsg(target, msg)
+}
+
+func (self *Session) Notice(target, msg string) {
+	self.at(module.PriorityNormal).Notice(target, msg)
+}
+
+func (self *Session) Action(target, msg string) {
+	self.at(module.PriorityNormal).Action(target, msg)
+}
+
+// Join a channel and rejoin it after reconnecting
+func (self *Session) Join(channel string, key ...string) {
+	self.at(module.PriorityNormal).Join(channel, key...)
+}
+
+// Part a channel and do not rejoin it after reconnecting
+func (self *Session) Part(channel string, message ...string) {
+	self.at(module.PriorityNormal).Part(channel, message...)
+}
+
+func (self *Session) Kick(channel, nick string, message ...string) {
+	self.at(module.PriorityNormal).Kick(channel, nick, message...)
+}
+
+func (self *Session) Topic(channel string, topic ...string) {
+	self.at(module.PriorityNormal).Topic(channel, topic...)
+}
@@ -0,0 +1,107 @@
+package irclib
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/crimsonvoid/irclib/module"
+)
+
+// Part of ServerInfo that is changed at runtime and saved to BotInfo.StateFile
+type managerState struct {
+	Access map[string]Groups
+}
+
+// Writes the access list to the state file, replacing it atomically, and saves
+// every module's state. Errors are returned by module name, "core" for ours
+func (self *ModManager) SaveState() map[string]error {
+	errMap := make(map[string]error)
+
+	if err := self.saveAccessState(); err != nil {
+		errMap["core"] = err
+	}
+
+	for _, mod := range self.Modules() {
+		if mod.StateFile() == "" {
+			continue
+		}
+
+		if err := mod.SaveState(); err != nil {
+			errMap[mod.Name()] = err
+		}
+	}
+
+	return errMap
+}
+
+// Replaces the access list and every module's allow/deny lists with those
+// saved in their state files. Errors are returned by module name, "core" for ours
+func (self *ModManager) LoadState() map[string]error {
+	errMap := make(map[string]error)
+
+	if err := self.loadAccessState(); err != nil {
+		errMap["core"] = err
+	}
+
+	for _, mod := range self.Modules() {
+		if err := mod.LoadState(); err != nil {
+			errMap[mod.Name()] = err
+		}
+	}
+
+	return errMap
+}
+
+// Writes the access list to the state file, replacing it atomically
+func (self *ModManager) saveAccessState() error {
+	if self.Config.StateFile == "" {
+		return nil
+	}
+
+	state := managerState{
+		Access: make(map[string]Groups),
+	}
+
+	for grp, users := range self.Config.Access.Groups() {
+		state.Access[grp] = Groups{users}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := toml.NewEncoder(buf).Encode(state); err != nil {
+		return err
+	}
+
+	self.stateMut.Lock()
+	defer self.stateMut.Unlock()
+
+	return module.WriteAtomic(self.Config.StateFile, buf.Bytes(), 0644)
+}
+
+// Replaces the access list with the one saved in the state file. A missing
+// state file is not an error
+func (self *ModManager) loadAccessState() error {
+	if self.Config.StateFile == "" {
+		return nil
+	}
+
+	state := new(managerState)
+	if _, err := toml.DecodeFile(self.Config.StateFile, state); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	self.Config.Access.set(state.Access)
+
+	return nil
+}
+
+// Saves the access list after a runtime change; errors are logged
+func (self *ModManager) saveAccess() {
+	if err := self.saveAccessState(); err != nil {
+		self.core.Logger.Errorln("ModManager.SaveState():", err)
+	}
+}
@@ -0,0 +1,179 @@
+package irclib
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/crimsonvoid/irclib/module"
+	irc "github.com/fluffle/goirc/client"
+)
+
+// Escapes an IRCv3 tag value
+var tagEscaper = strings.NewReplacer(`\`, `\\`, ";", `\:`, " ", `\s`, "\r", `\r`, "\n", `\n`)
+
+// Returns the tags of a raw line with their values unescaped, nil if it has none
+func parseTags(raw string) map[string]string {
+	if !strings.HasPrefix(raw, "@") {
+		return nil
+	}
+
+	end := strings.IndexByte(raw, ' ')
+	if end == -1 {
+		return nil
+	}
+
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(raw[1:end], ";") {
+		if tag == "" {
+			continue
+		}
+
+		key, value := tag, ""
+		if i := strings.IndexByte(tag, '='); i != -1 {
+			key, value = tag[:i], unescapeTag(tag[i+1:])
+		}
+
+		tags[key] = value
+	}
+
+	return tags
+}
+
+// Unescapes a tag value. Unknown escapes drop the backslash, as does a
+// trailing one
+func unescapeTag(value string) string {
+	if strings.IndexByte(value, '\\') == -1 {
+		return value
+	}
+
+	buf := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			buf = append(buf, value[i])
+			continue
+		}
+
+		if i++; i == len(value) {
+			break
+		}
+
+		switch c := value[i]; c {
+		case ':':
+			buf = append(buf, ';')
+		case 's':
+			buf = append(buf, ' ')
+		case 'r':
+			buf = append(buf, '\r')
+		case 'n':
+			buf = append(buf, '\n')
+		default:
+			buf = append(buf, c)
+		}
+	}
+
+	return string(buf)
+}
+
+// Returns tags as "@key=value;key2 " for the front of a line, or an empty
+// string. Keys are sorted so lines are stable
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for i, key := range keys {
+		if value := tags[key]; value != "" {
+			keys[i] = key + "=" + tagEscaper.Replace(value)
+		}
+	}
+
+	return "@" + strings.Join(keys, ";") + " "
+}
+
+// Splits message text into pieces of at most `splitLen` bytes like goirc does
+// for Privmsg() and Notice(), which tagged lines are not sent through. Pieces
+// are broken after a space or punctuation near the end where possible and all
+// but the last end in "..."
+func splitText(msg string, splitLen int) []string {
+	if splitLen < 13 {
+		splitLen = 450
+	}
+
+	pieces := make([]string, 0, len(msg)/splitLen+1)
+	for len(msg) > splitLen {
+		end := splitLen - 3
+		if i := strings.LastIndexAny(msg[splitLen-10:end], " :,;.!?-"); i != -1 {
+			end = splitLen - 10 + i + 1
+		}
+		for end > 1 && !utf8.RuneStart(msg[end]) {
+			end--
+		}
+
+		pieces = append(pieces, msg[:end]+"...")
+		msg = msg[end:]
+	}
+
+	return append(pieces, msg)
+}
+
+// Returns a copy of `line` with tags parsed from the raw line and its time
+// from the server-time tag. goirc shares lines between handlers, so `line` is
+// left as is
+func applyTags(line *irc.Line) *irc.Line {
+	tags := parseTags(line.Raw)
+	if tags == nil {
+		return line
+	}
+
+	line = line.Copy()
+	line.Tags = tags
+
+	if t, err := time.Parse(time.RFC3339Nano, tags["time"]); err == nil {
+		line.Time = t
+	}
+
+	return line
+}
+
+// Returns only the client-only tags ("+name") when the server supports
+// message-tags, otherwise nil
+func (self *Session) clientTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 || !self.HasCap("message-tags") {
+		return nil
+	}
+
+	clientOnly := make(map[string]string, len(tags))
+	for key, value := range tags {
+		if strings.HasPrefix(key, "+") {
+			clientOnly[key] = value
+		}
+	}
+
+	return clientOnly
+}
+
+// Sends a PRIVMSG with client-only tags such as "+draft/reply". Tags are
+// dropped if the server does not support message-tags
+func (self *Session) PrivmsgTags(target, msg string, tags map[string]string) {
+	self.at(module.PriorityNormal).PrivmsgTags(target, msg, tags)
+}
+
+// Sends a NOTICE with client-only tags. Tags are dropped if the server does
+// not support message-tags
+func (self *Session) NoticeTags(target, msg string, tags map[string]string) {
+	self.at(module.PriorityNormal).NoticeTags(target, msg, tags)
+}
+
+// Sends a TAGMSG, a message with only client-only tags such as reactions.
+// Returns false without sending if the server does not support message-tags
+func (self *Session) TagMsg(target string, tags map[string]string) bool {
+	return self.at(module.PriorityNormal).TagMsg(target, tags)
+}
@@ -0,0 +1,72 @@
+package irclib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTagsRoundTrip(t *testing.T) {
+	tests := []map[string]string{
+		{"+draft/reply": "abc123"},
+		{"+example": `semi;colon space\back\slash`},
+		{"+lines": "one\r\ntwo"},
+		{"+flag": "", "+draft/react": "👍"},
+		{"+trailing": `ends in \`},
+	}
+
+	for _, tags := range tests {
+		raw := formatTags(tags) + "PRIVMSG #bots :hi"
+		if got := parseTags(raw); !reflect.DeepEqual(got, tags) {
+			t.Errorf("parseTags(%q) = %q, want %q", raw, got, tags)
+		}
+	}
+}
+
+func TestUnescapeTag(t *testing.T) {
+	tests := map[string]string{
+		`plain`:     "plain",
+		`a\sb`:      "a b",
+		`a\:b`:      "a;b",
+		`a\\b`:      `a\b`,
+		`a\r\nb`:    "a\r\nb",
+		`unknown\x`: "unknownx",
+		`trailing\`: "trailing",
+		`\\s`:       `\s`,
+	}
+
+	for escaped, want := range tests {
+		if got := unescapeTag(escaped); got != want {
+			t.Errorf("unescapeTag(%q) = %q, want %q", escaped, got, want)
+		}
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	msg := strings.Repeat("word ", 40)
+	pieces := splitText(msg, 50)
+
+	if len(pieces) < 2 {
+		t.Fatalf("splitText returned %v pieces, want several", len(pieces))
+	}
+
+	joined := ""
+	for i, piece := range pieces {
+		if len(piece) > 50 {
+			t.Errorf("Piece %v is %v bytes, longer than 50", i, len(piece))
+		}
+
+		if i != len(pieces)-1 {
+			piece = strings.TrimSuffix(piece, "...")
+		}
+		joined += piece
+	}
+
+	if joined != msg {
+		t.Errorf("Pieces join to %q, want %q", joined, msg)
+	}
+
+	if got := splitText("short", 50); !reflect.DeepEqual(got, []string{"short"}) {
+		t.Errorf("splitText(short) = %q", got)
+	}
+}
@@ -0,0 +1,119 @@
+package irclib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// TLS settings for a network, used when Network.SSL is true
+type TLS struct {
+	CA          string // PEM bundle of CAs to trust instead of the system pool
+	Cert, Key   string // PEM client certificate and key for CertFP or SASL EXTERNAL
+	ServerName  string // Name verified against the certificate, defaults to Server
+	MinVersion  string // "1.0", "1.1", "1.2" or "1.3", defaults to "1.2"
+	Fingerprint string // SHA-256 fingerprint of the server certificate to pin
+	Insecure    bool   // Skip certificate verification
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Builds a tls.Config from the [network.tls] section. Errors name the setting
+// and file that could not be used
+func (network *Network) configTLS() (*tls.Config, error) {
+	t := network.TLS
+
+	cfg := &tls.Config{
+		ServerName:         network.Server,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: t.Insecure,
+	}
+
+	if t.ServerName != "" {
+		cfg.ServerName = t.ServerName
+	}
+
+	if t.MinVersion != "" {
+		version, ok := tlsVersions[t.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("TLS MinVersion %v is not one of 1.0, 1.1, 1.2 or 1.3",
+				t.MinVersion)
+		}
+
+		cfg.MinVersion = version
+	}
+
+	if t.CA != "" {
+		pem, err := ioutil.ReadFile(t.CA)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read TLS CA %v: %v", t.CA, err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No PEM certificates found in TLS CA %v", t.CA)
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	switch {
+	case t.Cert != "" && t.Key != "":
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load TLS Cert %v and Key %v: %v",
+				t.Cert, t.Key, err)
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	case t.Cert != "" || t.Key != "":
+		return nil, errors.New("Specify both a TLS Cert and Key in the config file")
+	}
+
+	if t.Fingerprint != "" {
+		pin, err := parseFingerprint(t.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+
+		// A pinned certificate replaces chain verification, which allows
+		// self-signed certificates
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("Server did not send a certificate")
+			}
+
+			sum := sha256.Sum256(rawCerts[0])
+			if !bytes.Equal(sum[:], pin) {
+				return fmt.Errorf("Server certificate fingerprint %v does not match %v",
+					hex.EncodeToString(sum[:]), t.Fingerprint)
+			}
+
+			return nil
+		}
+	}
+
+	return cfg, nil
+}
+
+// Parses a hex SHA-256 fingerprint, optionally separated by colons
+func parseFingerprint(fp string) ([]byte, error) {
+	pin, err := hex.DecodeString(strings.Replace(fp, ":", "", -1))
+	if err != nil || len(pin) != sha256.Size {
+		return nil, fmt.Errorf("TLS Fingerprint %v is not a hex SHA-256 fingerprint", fp)
+	}
+
+	return pin, nil
+}
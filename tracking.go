@@ -0,0 +1,218 @@
+package irclib
+
+import (
+	"strings"
+
+	"github.com/crimsonvoid/irclib/module"
+	irc "github.com/fluffle/goirc/client"
+	"github.com/fluffle/goirc/state"
+)
+
+// Registers handlers that track away status from away-notify, RPL_AWAY and
+// our own RPL_UNAWAY/RPL_NOWAWAY. Channels and users are tracked by goirc
+func (self *Session) setupTracking() {
+	// away-notify: AWAY [:message]; no message means back
+	self.Conn.HandleFunc("AWAY", func(con *irc.Conn, line *irc.Line) {
+		if len(line.Args) == 0 || line.Args[0] == "" {
+			self.setAway(line.Nick, false, "")
+		} else {
+			self.setAway(line.Nick, true, line.Args[0])
+		}
+	})
+
+	// RPL_AWAY: me nick :message
+	self.Conn.HandleFunc("301", func(con *irc.Conn, line *irc.Line) {
+		if len(line.Args) == 3 {
+			self.setAway(line.Args[1], true, line.Args[2])
+		}
+	})
+
+	// RPL_UNAWAY
+	self.Conn.HandleFunc("305", func(con *irc.Conn, line *irc.Line) {
+		self.setAway(self.Nick(), false, "")
+	})
+
+	// RPL_NOWAWAY
+	self.Conn.HandleFunc("306", func(con *irc.Conn, line *irc.Line) {
+		self.setAway(self.Nick(), true, "")
+	})
+
+	self.Conn.HandleFunc(irc.NICK, func(con *irc.Conn, line *irc.Line) {
+		if len(line.Args) == 0 {
+			return
+		}
+
+		self.mut.Lock()
+		defer self.mut.Unlock()
+
+		old := strings.ToLower(line.Nick)
+		if msg, ok := self.away[old]; ok {
+			delete(self.away, old)
+			self.away[strings.ToLower(line.Args[0])] = msg
+		}
+	})
+
+	self.Conn.HandleFunc(irc.QUIT, func(con *irc.Conn, line *irc.Line) {
+		self.setAway(line.Nick, false, "")
+	})
+
+	self.Conn.HandleFunc(irc.DISCONNECTED, func(con *irc.Conn, line *irc.Line) {
+		self.mut.Lock()
+		self.away = make(map[string]string)
+		self.mut.Unlock()
+	})
+}
+
+// Records whether `nick` is away. A message is kept if the new one is unknown
+func (self *Session) setAway(nick string, away bool, msg string) {
+	if nick == "" {
+		return
+	}
+
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	nick = strings.ToLower(nick)
+	if !away {
+		delete(self.away, nick)
+	} else if old, ok := self.away[nick]; !ok || msg != "" || old == "" {
+		self.away[nick] = msg
+	}
+}
+
+// Returns true if tracking is enabled for the network
+func (self *Session) Tracking() bool {
+	return self.Conn.StateTracker() != nil
+}
+
+// Returns the lowered names of the channels the bot is on
+func (self *Session) Channels() []string {
+	st := self.Conn.StateTracker()
+	if st == nil {
+		return nil
+	}
+
+	me := st.Me()
+	if me == nil {
+		return nil
+	}
+
+	chans := make([]string, 0, len(me.Channels))
+	for ch := range me.Channels {
+		chans = append(chans, strings.ToLower(ch))
+	}
+
+	return chans
+}
+
+// Returns a copy of a channel the bot is on or nil
+func (self *Session) Channel(name string) *module.Channel {
+	st := self.Conn.StateTracker()
+	if st == nil {
+		return nil
+	}
+
+	ch := st.GetChannel(name)
+	if ch == nil {
+		return nil
+	}
+
+	channel := &module.Channel{
+		Name:    ch.Name,
+		Topic:   ch.Topic,
+		Members: make([]module.Member, 0, len(ch.Nicks)),
+	}
+
+	if ch.Modes != nil {
+		channel.Modes = ch.Modes.String()
+		channel.Key = ch.Modes.Key
+		channel.Limit = ch.Modes.Limit
+	}
+
+	for nick, cp := range ch.Nicks {
+		channel.Members = append(channel.Members, module.Member{Nick: nick, Privs: privs(cp)})
+	}
+	module.SortMembers(channel.Members)
+
+	return channel
+}
+
+// Returns a copy of a user sharing a channel with the bot, or the bot, or nil
+func (self *Session) User(nick string) *module.User {
+	st := self.Conn.StateTracker()
+	if st == nil {
+		return nil
+	}
+
+	nk := st.GetNick(nick)
+	if nk == nil {
+		return nil
+	}
+
+	user := &module.User{
+		Nick:     nk.Nick,
+		Ident:    nk.Ident,
+		Host:     nk.Host,
+		Name:     nk.Name,
+		Account:  self.Account(nk.Nick),
+		Channels: make(map[string]module.Privs, len(nk.Channels)),
+	}
+
+	if nk.Modes != nil {
+		user.Modes = nk.Modes.String()
+	}
+
+	for ch, cp := range nk.Channels {
+		user.Channels[strings.ToLower(ch)] = privs(cp)
+	}
+
+	self.mut.RLock()
+	user.AwayMsg, user.Away = self.away[strings.ToLower(nk.Nick)]
+	self.mut.RUnlock()
+
+	return user
+}
+
+// Returns the privileges of `nick` in `channel` and true if it is on the channel
+func (self *Session) IsOn(channel, nick string) (module.Privs, bool) {
+	st := self.Conn.StateTracker()
+	if st == nil {
+		return module.Privs{}, false
+	}
+
+	cp, ok := st.IsOn(channel, nick)
+
+	return privs(cp), ok
+}
+
+// Returns the State of a network or nil if there is no such network
+func (self *ModManager) State(network string) module.State {
+	if s := self.Session(network); s != nil {
+		return s
+	}
+
+	return nil
+}
+
+// Enables or disables goirc's tracking; only safe while disconnected
+func (self *Session) setTracking(enabled bool) {
+	if enabled {
+		self.Conn.EnableStateTracking()
+	} else {
+		self.Conn.DisableStateTracking()
+	}
+}
+
+func privs(cp *state.ChanPrivs) module.Privs {
+	if cp == nil {
+		return module.Privs{}
+	}
+
+	return module.Privs{
+		Owner:  cp.Owner,
+		Admin:  cp.Admin,
+		Op:     cp.Op,
+		HalfOp: cp.HalfOp,
+		Voice:  cp.Voice,
+	}
+}
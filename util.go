@@ -27,6 +27,24 @@ func remove(list *[]string, target string) bool {
 	return false
 }
 
+// Returns true if `target` is a channel name
+func isChannel(target string) bool {
+	return target != "" && strings.IndexByte("#&+!", target[0]) != -1
+}
+
+// Returns true if 'target' is in 'list'; 'list' is expected to be lowered
+func inList(list []string, target string) bool {
+	target = strings.ToLower(target)
+
+	for _, v := range list {
+		if v == target {
+			return true
+		}
+	}
+
+	return false
+}
+
 func matchGroups(reg *regexp.Regexp, s string) (map[string]string, error) {
 	groups := make(map[string]string)
 	res := reg.FindStringSubmatch(s)
@@ -5,6 +5,9 @@ import (
 	"os"
 )
 
+// Events from users in this access group are dropped before modules see them
+const BlacklistGroup = "blacklist"
+
 var (
 	consLog = log.New(os.Stdout, "", 0)
 )
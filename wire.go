@@ -0,0 +1,172 @@
+package irclib
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	irc "github.com/fluffle/goirc/client"
+	"golang.org/x/net/proxy"
+)
+
+// goirc only exposes whole lines to handlers registered per command, so every
+// Session dials through a "proxy" registered with goirc's proxy support. It
+// does TLS itself and sees each raw line in both directions
+const wireScheme = "irclib"
+
+// Sessions of running ModManagers by wire ID
+var wires = struct {
+	sessions map[string]*Session
+	next     int
+	once     sync.Once // Registers the dialer on the first connect
+	sync.Mutex
+}{sessions: make(map[string]*Session)}
+
+func dialWire(u *url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
+	wires.Lock()
+	s, ok := wires.sessions[u.Host]
+	wires.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("No session for %v", u)
+	}
+
+	return &wireDialer{s, forward}, nil
+}
+
+// Lets the Session's connection be dialed through its wire
+func (self *Session) addWire() {
+	wires.once.Do(func() {
+		proxy.RegisterDialerType(wireScheme, dialWire)
+	})
+
+	wires.Lock()
+	wires.sessions[self.wireID] = self
+	wires.Unlock()
+}
+
+// Forgets the Session once it is no longer connected or reconnecting
+func (self *Session) removeWire() {
+	wires.Lock()
+	delete(wires.sessions, self.wireID)
+	wires.Unlock()
+}
+
+// Routes a goirc config through the Session's wire. TLS moves from goirc to
+// the wire so lines are seen in plain text
+func (self *Session) wireConfig(cfg *irc.Config) {
+	wires.Lock()
+	if self.wireID == "" {
+		wires.next++
+		self.wireID = fmt.Sprintf("session%v", wires.next)
+	}
+	wires.Unlock()
+
+	self.tlsConfig = nil
+	if cfg.SSL {
+		self.tlsConfig = cfg.SSLConfig
+		if self.tlsConfig == nil {
+			self.tlsConfig = new(tls.Config)
+		}
+
+		cfg.SSL, cfg.SSLConfig = false, nil
+	}
+
+	cfg.Proxy = wireScheme + "://" + self.wireID
+}
+
+type wireDialer struct {
+	s       *Session
+	forward proxy.Dialer
+}
+
+func (self *wireDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := self.forward.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	self.s.mut.RLock()
+	tlsConfig := self.s.tlsConfig
+	self.s.mut.RUnlock()
+
+	if tlsConfig != nil {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+
+			return nil, err
+		}
+
+		conn = tlsConn
+	}
+
+	// goirc runs its REGISTER handlers concurrently, so CAP LS is sent here to
+	// reach the server before NICK and USER
+	wc := &wireConn{Conn: conn, s: self.s}
+	self.s.resetCaps()
+	if _, err := wc.Write([]byte("CAP LS 302\r\n")); err != nil {
+		conn.Close()
+
+		return nil, err
+	}
+
+	return wc, nil
+}
+
+// Calls Session.wire() with every complete line read or written
+type wireConn struct {
+	net.Conn
+	s *Session
+
+	rbuf, wbuf []byte
+	wmut       sync.Mutex
+}
+
+func (self *wireConn) Read(p []byte) (int, error) {
+	n, err := self.Conn.Read(p)
+	if n > 0 {
+		self.rbuf = self.split(append(self.rbuf, p[:n]...), false)
+	}
+
+	return n, err
+}
+
+func (self *wireConn) Write(p []byte) (int, error) {
+	// Waits for flood control before the lines are seen as sent
+	self.s.sendq.write(p)
+
+	self.wmut.Lock()
+	self.wbuf = self.split(append(self.wbuf, p...), true)
+	self.wmut.Unlock()
+
+	return self.Conn.Write(p)
+}
+
+// Passes complete lines in `buf` to the Session and returns what is left
+func (self *wireConn) split(buf []byte, sent bool) []byte {
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i == -1 {
+			return buf
+		}
+
+		if line := strings.TrimRight(string(buf[:i]), "\r"); line != "" {
+			self.s.wire(line, sent)
+		}
+
+		buf = buf[i+1:]
+	}
+}
+
+// Called with every raw line sent or received on the network
+func (self *Session) wire(line string, sent bool) {
+	self.manager.record(self.Name, line, sent)
+	self.routeQuery(line, sent)
+	self.routeBatch(line, sent)
+	self.manager.runWire(self, line, sent)
+}